@@ -0,0 +1,261 @@
+package impast
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/gob"
+	"encoding/hex"
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"os"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"time"
+	"weak"
+)
+
+const summaryVersion = 2
+
+type fileStamp struct {
+	modTime time.Time
+	size    int64
+	hash    [sha256.Size]byte
+}
+
+type cacheEntry struct {
+	pkg        *ast.Package
+	importPath string
+	path       string
+	dir        string
+	tests      bool
+	stamps     map[string]fileStamp
+	loadedAt   time.Time
+}
+
+type CacheEntry struct {
+	ImportPath string
+	Path       string
+	Dir        string
+	Name       string
+	Files      []string
+	LoadedAt   time.Time
+}
+
+func (i *Importer) Cached() []CacheEntry {
+	var entries []CacheEntry
+	i.cache.Range(func(key, value interface{}) bool {
+		e := value.(*cacheEntry)
+		entries = append(entries, CacheEntry{
+			ImportPath: e.importPath,
+			Path:       e.path,
+			Dir:        e.dir,
+			Name:       e.pkg.Name,
+			Files:      sortedNames(e.pkg.Files),
+			LoadedAt:   e.loadedAt,
+		})
+		return true
+	})
+	sort.Slice(entries, func(i, j int) bool {
+		if entries[i].ImportPath != entries[j].ImportPath {
+			return entries[i].ImportPath < entries[j].ImportPath
+		}
+		return entries[i].Name < entries[j].Name
+	})
+	return entries
+}
+
+func (i *Importer) Stale(importPath string) bool {
+	stale := false
+	i.cache.Range(func(key, value interface{}) bool {
+		if e := value.(*cacheEntry); e.matches(key.(string), importPath) && i.stale(e) {
+			stale = true
+			return false
+		}
+		return true
+	})
+	return stale
+}
+
+func (i *Importer) stale(e *cacheEntry) bool {
+	if e.dir == "" {
+		return false
+	}
+	infos, err := i.readDirInfos(e.dir)
+	if err != nil {
+		return true
+	}
+	n := 0
+	for _, info := range infos {
+		if !i.matchFile(e.dir, info, e.tests) {
+			continue
+		}
+		filename := filepath.Join(e.dir, info.Name())
+		st, ok := e.stamps[filename]
+		if !ok {
+			return true
+		}
+		n++
+		if !st.modTime.IsZero() && st.modTime.Equal(info.ModTime()) && st.size == info.Size() {
+			continue
+		}
+		src, err := i.readFile(filename)
+		if err != nil || sha256.Sum256(src) != st.hash {
+			return true
+		}
+	}
+	return n != len(e.stamps)
+}
+
+func (i *Importer) Invalidate(importPath string) {
+	i.cache.Range(func(key, value interface{}) bool {
+		if e := value.(*cacheEntry); e.matches(key.(string), importPath) {
+			i.forget(key.(string), e)
+		}
+		return true
+	})
+}
+
+func (i *Importer) Reset() {
+	var files []*token.File
+	i.FileSet().Iterate(func(f *token.File) bool {
+		files = append(files, f)
+		return true
+	})
+	for _, f := range files {
+		i.FileSet().RemoveFile(f)
+	}
+	i.cache.Clear()
+	i.roots.Clear()
+	i.files.Clear()
+	i.packages.Clear()
+	i.indexes.Clear()
+	i.typesPkgs.Clear()
+}
+
+// matches reports whether the entry stored under key was imported as importPath,
+// from any module, or has importPath as its canonical path.
+func (e *cacheEntry) matches(key, importPath string) bool {
+	return key == importPath || e.importPath == importPath || e.path == importPath
+}
+
+func (i *Importer) forget(key string, e *cacheEntry) {
+	i.cache.Delete(key)
+	parsed := false
+	if info, ok := i.loadedPackage(e.pkg); ok {
+		parsed = info.parsed
+	}
+	i.unregister(weak.Make(e.pkg))
+	for _, f := range e.pkg.Files {
+		i.unregisterFile(weak.Make(f))
+		if parsed {
+			i.removeFile(f)
+		}
+	}
+	// type-checked dependents may refer to the forgotten package.
+	i.typesPkgs.Clear()
+}
+
+type summary struct {
+	Files map[string][]byte
+}
+
+func DefaultCacheDir() (string, error) {
+	dir, err := os.UserCacheDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "impast"), nil
+}
+
+func (i *Importer) summaryPath(srcs map[string][]byte) string {
+	h := sha256.New()
+	gob.NewEncoder(h).Encode([]interface{}{summaryVersion, runtime.Version(), i.Mode})
+	for _, filename := range sortedNames(srcs) {
+		sum := sha256.Sum256(srcs[filename])
+		h.Write([]byte(filename))
+		h.Write(sum[:])
+	}
+	key := hex.EncodeToString(h.Sum(nil))
+	return filepath.Join(i.CacheDir, key[:2], key)
+}
+
+func (i *Importer) loadSummary(srcs map[string][]byte) (map[string]*ast.File, bool) {
+	data, err := os.ReadFile(i.summaryPath(srcs))
+	if err != nil {
+		return nil, false
+	}
+	var s summary
+	if err := gob.NewDecoder(bytes.NewReader(data)).Decode(&s); err != nil || len(s.Files) != len(srcs) {
+		return nil, false
+	}
+	files := map[string]*ast.File{}
+	for _, filename := range sortedNames(s.Files) {
+		f, err := parser.ParseFile(i.FileSet(), filename, s.Files[filename], i.Mode)
+		if err != nil {
+			return nil, false
+		}
+		files[filename] = f
+	}
+	return files, true
+}
+
+// storeSummary writes the sources with the function bodies, which are never inspected by
+// impast, blanked out. Lines and columns of the remaining declarations are kept, so that
+// the summary is parsed to the same positions without rewriting the parsed files.
+func (i *Importer) storeSummary(srcs map[string][]byte, files map[string]*ast.File) {
+	s := summary{Files: map[string][]byte{}}
+	for filename, f := range files {
+		tf := i.FileSet().File(f.Pos())
+		if tf == nil {
+			return
+		}
+		src := srcs[filename]
+		var b []byte
+		prev := 0
+		for _, decl := range f.Decls {
+			fn, ok := decl.(*ast.FuncDecl)
+			if !ok || fn.Body == nil {
+				continue
+			}
+			start, end := tf.Offset(fn.Body.Lbrace), tf.Offset(fn.Body.Rbrace)+1
+			b = append(b, src[prev:start]...)
+			b = append(b, blank(src[start:end])...)
+			prev = end
+		}
+		s.Files[filename] = append(b, src[prev:]...)
+	}
+
+	var b bytes.Buffer
+	if err := gob.NewEncoder(&b).Encode(&s); err != nil {
+		return
+	}
+	path := i.summaryPath(srcs)
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(path), "summary-*")
+	if err != nil {
+		return
+	}
+	_, err = tmp.Write(b.Bytes())
+	if cerr := tmp.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		os.Remove(tmp.Name())
+		return
+	}
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		os.Remove(tmp.Name())
+	}
+}
+
+// blank replaces src with the same line breaks. Only the last line is padded, since the
+// source following it keeps its column.
+func blank(src []byte) []byte {
+	n := bytes.Count(src, []byte("\n"))
+	last := len(src) - bytes.LastIndexByte(src, '\n') - 1
+	return append(bytes.Repeat([]byte("\n"), n), bytes.Repeat([]byte(" "), last)...)
+}
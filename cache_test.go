@@ -0,0 +1,283 @@
+package impast_test
+
+import (
+	"fmt"
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"io/fs"
+	"path/filepath"
+	"reflect"
+	"runtime"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/orisano/impast"
+)
+
+func TestImporter_CacheDir(t *testing.T) {
+	src := t.TempDir()
+	writeFiles(t, src, map[string]string{
+		"foo.go": `package foo
+
+type Foo struct{}
+
+func (f *Foo) Do(n int) error {
+	return nil
+}
+`,
+	})
+	cacheDir := t.TempDir()
+
+	countEntries := func() int {
+		n := 0
+		filepath.WalkDir(cacheDir, func(path string, d fs.DirEntry, err error) error {
+			if err == nil && !d.IsDir() {
+				n++
+			}
+			return nil
+		})
+		return n
+	}
+
+	methods := func(cached bool) []string {
+		imp := &impast.Importer{CacheDir: cacheDir}
+		pkg, err := imp.ImportFrom(".", src)
+		if err != nil {
+			t.Fatalf("failed to import: %v", err)
+		}
+		ms, err := imp.GetMethodsDeep(pkg, "Foo")
+		if err != nil {
+			t.Fatalf("failed to get methods: %v", err)
+		}
+		var got []string
+		for _, m := range ms {
+			if cached && m.Body != nil {
+				t.Errorf("function body should be stripped: %v", m.Name.Name)
+			}
+			got = append(got, signature(m))
+		}
+		return got
+	}
+
+	first := methods(false)
+	if n := countEntries(); n != 1 {
+		t.Fatalf("unexpected cache entries. expected: 1, but got: %v", n)
+	}
+	if second := methods(true); !reflect.DeepEqual(first, second) {
+		t.Errorf("cached methods mismatch. expected: %v, but got: %v", first, second)
+	}
+	if n := countEntries(); n != 1 {
+		t.Errorf("unexpected cache entries. expected: 1, but got: %v", n)
+	}
+
+	writeFiles(t, src, map[string]string{
+		"bar.go": `package foo
+
+func (f *Foo) Bar() {}
+`,
+	})
+	expected := []string{"Bar()()", "Do(int)(error)"}
+	if got := methods(false); !reflect.DeepEqual(got, expected) {
+		t.Errorf("stale cache. expected: %v, but got: %v", expected, got)
+	}
+	if n := countEntries(); n != 2 {
+		t.Errorf("unexpected cache entries. expected: 2, but got: %v", n)
+	}
+}
+
+func TestImporter_CacheDirComments(t *testing.T) {
+	src := t.TempDir()
+	writeFiles(t, src, map[string]string{
+		"foo.go": `package foo
+
+type Foo struct{}
+
+// Do does n times.
+func (f *Foo) Do(n int) error {
+	// not a doc comment.
+	for i := 0; i < n; i++ {
+	}
+	return nil
+}
+
+// Run runs.
+func (f *Foo) Run() { f.Do(1) } // Run trails.
+
+/* Stop stops. */ func (f *Foo) Stop() {}
+`,
+	})
+	cacheDir := t.TempDir()
+
+	methods := func() []string {
+		imp := &impast.Importer{CacheDir: cacheDir, Mode: parser.ParseComments}
+		pkg, err := imp.ImportFrom(".", src)
+		if err != nil {
+			t.Fatalf("failed to import: %v", err)
+		}
+		ms, err := imp.GetMethodsDeep(pkg, "Foo")
+		if err != nil {
+			t.Fatalf("failed to get methods: %v", err)
+		}
+		var got []string
+		for _, m := range ms {
+			pos := imp.Position(m.Name.Pos())
+			got = append(got, fmt.Sprintf("%v:%v:%v %q", filepath.Base(pos.Filename), pos.Line, pos.Column, m.Doc.Text()))
+		}
+		f := pkg.Files[filepath.Join(src, "foo.go")]
+		for _, cg := range f.Comments {
+			pos := imp.Position(cg.Pos())
+			got = append(got, fmt.Sprintf("%v:%v %q", pos.Line, pos.Column, cg.Text()))
+		}
+		return got
+	}
+
+	expected := []string{
+		`foo.go:6:15 "Do does n times.\n"`,
+		`foo.go:14:15 "Run runs.\n"`,
+		`foo.go:16:33 ""`,
+		`5:1 "Do does n times.\n"`,
+		`13:1 "Run runs.\n"`,
+		`14:33 "Run trails.\n"`,
+		`16:1 " Stop stops.\n"`,
+	}
+	// the parsed files are returned as they are, the summary leaves the bodies out.
+	parsed := append(slices.Clone(expected[:4]), `7:2 "not a doc comment.\n"`)
+	parsed = append(parsed, expected[4:]...)
+	if got := methods(); !reflect.DeepEqual(got, parsed) {
+		t.Errorf("unexpected methods. expected: %q, but got: %q", parsed, got)
+	}
+	if got := methods(); !reflect.DeepEqual(got, expected) {
+		t.Errorf("unexpected cached methods. expected: %q, but got: %q", expected, got)
+	}
+}
+
+func TestImporter_Uncached(t *testing.T) {
+	src := t.TempDir()
+	writeFiles(t, src, map[string]string{
+		"foo.go": "package foo\n\ntype Foo struct{}\n\nfunc (f *Foo) Do() {}\n",
+	})
+
+	imp := &impast.Importer{}
+	collected := make(chan struct{}, 2)
+	func() {
+		pkg, err := imp.ImportFrom(".", src)
+		if err != nil {
+			t.Fatalf("failed to import: %v", err)
+		}
+		if _, err := imp.GetMethodsDeep(pkg, "Foo"); err != nil {
+			t.Fatalf("failed to get methods: %v", err)
+		}
+		if _, ok := imp.ImportPath(pkg); !ok {
+			t.Error("imported package must be registered")
+		}
+		runtime.AddCleanup(pkg, func(ch chan struct{}) { ch <- struct{}{} }, collected)
+		for _, f := range pkg.Files {
+			runtime.AddCleanup(f, func(ch chan struct{}) { ch <- struct{}{} }, collected)
+		}
+	}()
+
+	// packages which are not cached must not be kept alive by the importer.
+	for n := 0; n < 2; {
+		runtime.GC()
+		select {
+		case <-collected:
+			n++
+		case <-time.After(time.Second):
+			t.Fatal("uncached package is still referenced by the importer")
+		}
+	}
+	for deadline := time.Now().Add(time.Second); ; {
+		n := 0
+		imp.FileSet().Iterate(func(*token.File) bool {
+			n++
+			return true
+		})
+		if n == 0 {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("files of collected packages must be removed from the file set: %v files", n)
+		}
+		runtime.GC()
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestImporter_Revalidate(t *testing.T) {
+	src := t.TempDir()
+	writeFiles(t, src, map[string]string{
+		"foo.go": "package foo\n\ntype Foo struct{}\n",
+	})
+
+	imp := &impast.Importer{EnableCache: true, Revalidate: true, Dir: src}
+	first, err := imp.ImportPackage(".")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if again, _ := imp.ImportPackage("."); again != first {
+		t.Error("fresh package should be served from cache")
+	}
+	if imp.Stale(src) {
+		t.Error("package should not be stale")
+	}
+
+	writeFiles(t, src, map[string]string{
+		"bar.go": "package foo\n\ntype Bar struct{}\n",
+	})
+	if !imp.Stale(src) {
+		t.Error("package should be stale after adding a file")
+	}
+	second, err := imp.ImportPackage(".")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if second == first || impast.FindStruct(second, "Bar") == nil {
+		t.Error("stale package should be reloaded")
+	}
+	countFiles := func() int {
+		n := 0
+		imp.FileSet().Iterate(func(*token.File) bool {
+			n++
+			return true
+		})
+		return n
+	}
+	if n := countFiles(); n != 2 {
+		t.Errorf("files of the stale package must be removed from the file set: %v files", n)
+	}
+
+	entries := imp.Cached()
+	if len(entries) != 1 {
+		t.Fatalf("unexpected cached entries: %+v", entries)
+	}
+	expectedFiles := []string{filepath.Join(src, "bar.go"), filepath.Join(src, "foo.go")}
+	if e := entries[0]; e.Name != "foo" || e.Dir != src || !reflect.DeepEqual(e.Files, expectedFiles) {
+		t.Errorf("unexpected cached entry: %+v", e)
+	}
+
+	imp.Invalidate(src)
+	if len(imp.Loaded()) != 0 {
+		t.Errorf("invalidated package is still loaded: %v", imp.Loaded())
+	}
+	third, err := imp.ImportPackage(".")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if third == second {
+		t.Error("invalidated package should be reloaded")
+	}
+	if n := countFiles(); n != 2 {
+		t.Errorf("files of the invalidated package must be removed from the file set: %v files", n)
+	}
+
+	imp.Load(map[string]*ast.Package{"example.com/a": {Name: "a"}})
+	imp.Reset()
+	if len(imp.Cached()) != 0 {
+		t.Errorf("reset importer still has cached entries: %+v", imp.Cached())
+	}
+	if n := countFiles(); n != 0 {
+		t.Errorf("reset importer still has %v files in the file set", n)
+	}
+}
@@ -5,8 +5,11 @@ import (
 	"flag"
 	"fmt"
 	"go/ast"
-	"go/printer"
+	"go/build"
+	"go/format"
+	"go/parser"
 	"go/token"
+	"io"
 	"log"
 	"os"
 	"strings"
@@ -18,6 +21,14 @@ import (
 func main() {
 	interfaceName := flag.String("out", "", "generate interface name (required)")
 	pkgName := flag.String("pkg", "", "generate interface package name")
+	dir := flag.String("dir", "", "directory to resolve imports from")
+	tags := flag.String("tags", "", "comma-separated list of build tags")
+	cache := flag.Bool("cache", false, "cache parsed packages on disk")
+	comments := flag.Bool("comments", false, "copy method documentation")
+	overlay := flag.String("overlay", "", "JSON file in the go build -overlay format")
+	tests := flag.Bool("tests", false, "include in-package _test.go files")
+	value := flag.Bool("value", false, "use the method set of the value instead of the pointer")
+	localPath := flag.String("local", "", "import path of the package to generate into")
 
 	flag.Parse()
 
@@ -31,101 +42,196 @@ func main() {
 	}
 
 	impast.DefaultImporter.EnableCache = true
+	impast.DefaultImporter.Dir = *dir
+	impast.DefaultImporter.Tests = *tests
+	if *tags != "" {
+		ctx := build.Default
+		ctx.BuildTags = strings.Split(*tags, ",")
+		impast.DefaultImporter.Context = &ctx
+	}
+	if *overlay != "" {
+		m, err := impast.ReadOverlay(*overlay)
+		if err != nil {
+			log.Fatalf("failed to read overlay: %v", err)
+		}
+		impast.DefaultImporter.Overlay = m
+	}
+	if *comments {
+		impast.DefaultImporter.Mode = parser.ParseComments
+	}
+	if *cache {
+		cacheDir, err := impast.DefaultCacheDir()
+		if err != nil {
+			log.Fatalf("failed to get cache dir: %v", err)
+		}
+		impast.DefaultImporter.CacheDir = cacheDir
+	}
+
+	var local string
+	if *localPath != "" {
+		p, err := impast.ImportPackage(*localPath)
+		if err != nil {
+			log.Fatalf("failed to import package (%v): %v", *localPath, err)
+		}
+		local, _ = impast.DefaultImporter.ImportPath(p)
+	}
+
+	var im impast.Imports
+	m, typeParams, err := lookupMethods(&impast.DefaultImporter, &im, flag.Args(), !*value)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	src, err := generate(*interfaceName, *pkgName, local, &im, typeParams, m)
+	if err != nil {
+		log.Fatal(err)
+	}
+	os.Stdout.Write(src)
+}
 
+// lookupMethods returns the methods common to the method sets of types, each written as
+// pkgPath.TypeName, and the type parameters they share exported to im.
+func lookupMethods(imp *impast.Importer, im *impast.Imports, types []string, pointer bool) ([]*ast.FuncDecl, *ast.FieldList, error) {
+	// signatures are compared by the import paths of their qualifiers, not by the names
+	// the source files happen to use.
+	var keys impast.Imports
 	var m []*ast.FuncDecl
-	for _, t := range flag.Args() {
+	var typeParams *ast.FieldList
+	var typeParamsKey string
+	for i, t := range types {
 		index := strings.LastIndexByte(t, '.')
 		if index == -1 {
-			log.Fatalf("invalid type: %v", t)
+			return nil, nil, fmt.Errorf("invalid type: %v", t)
 		}
 		pkgPath := t[:index]
 		typeName := t[index+1:]
 
-		pkg, err := impast.ImportPackage(pkgPath)
+		pkg, err := imp.ImportPackage(pkgPath)
 		if err != nil {
-			log.Fatalf("failed to import package (%v): %v", pkgPath, err)
+			return nil, nil, fmt.Errorf("failed to import package (%v): %w", pkgPath, err)
 		}
 
-		methods, err := impast.GetMethodsDeep(pkg, typeName)
+		ms, err := imp.LookupMethodSet(pkg, typeName, pointer)
 		if err != nil {
-			log.Fatalf("failed to get methods %v.%v: %v", pkg.Name, typeName, err)
+			return nil, nil, fmt.Errorf("failed to get methods %v.%v: %w", pkg.Name, typeName, err)
+		}
+		for _, name := range ms.Ambiguous {
+			log.Printf("warning: ambiguous selector %v.%v.%v is excluded", pkg.Name, typeName, name)
+		}
+		m = intersectionMethods(&keys, m, ms.Methods)
+
+		var key string
+		typeSpec, file := imp.FindTypeSpec(pkg, typeName)
+		if typeSpec != nil {
+			tparams, err := imp.ExportTypeParamsTo(&keys, pkg, file, typeSpec.TypeParams)
+			if err != nil {
+				return nil, nil, fmt.Errorf("failed to export type parameters %v: %w", t, err)
+			}
+			key = typeParamsString(tparams)
+		}
+		if i == 0 {
+			typeParamsKey = key
+			if typeSpec != nil {
+				typeParams, err = imp.ExportTypeParamsTo(im, pkg, file, typeSpec.TypeParams)
+				if err != nil {
+					return nil, nil, fmt.Errorf("failed to export type parameters %v: %w", t, err)
+				}
+			}
+		} else if typeParamsKey != key {
+			return nil, nil, fmt.Errorf("mismatched type parameters %v: %v", t, key)
 		}
-		m = intersectionMethods(m, methods)
 	}
+	return m, typeParams, nil
+}
 
-	it := &ast.InterfaceType{
-		Methods: &ast.FieldList{},
+// generate returns the source of the interface. A file of package pkgName importing
+// the packages of im is generated if it is not empty, otherwise only the declaration.
+// The qualifiers of methods are added to im, and those of the package of the import
+// path local are removed.
+func generate(name, pkgName, local string, im *impast.Imports, tparams *ast.FieldList, methods []*ast.FuncDecl) ([]byte, error) {
+	for _, method := range methods {
+		method.Type = im.Qualify(method.Type).(*ast.FuncType)
+		if local != "" {
+			method.Type = im.Localize(local, method.Type).(*ast.FuncType)
+		}
 	}
-	for _, method := range m {
-		it.Methods.List = append(it.Methods.List, &ast.Field{
-			Type:  method.Type,
-			Names: []*ast.Ident{method.Name},
-		})
+	if local != "" {
+		tparams = im.LocalizeFields(local, tparams)
 	}
-	decl := &ast.GenDecl{
-		Tok: token.TYPE,
-		Specs: []ast.Spec{
-			&ast.TypeSpec{
-				Name: ast.NewIdent(*interfaceName),
-				Type: it,
-			},
-		},
+	var decl bytes.Buffer
+	writeInterface(&decl, name, tparams, methods)
+
+	if pkgName == "" {
+		src, err := format.Source(decl.Bytes())
+		if err != nil {
+			return nil, fmt.Errorf("failed to format: %w", err)
+		}
+		return append(src, '\n'), nil
 	}
 
-	if *pkgName != "" {
-		var b bytes.Buffer
-		fmt.Fprintln(&b, `// Code generated by 'interfacer'; DO NOT EDIT.`)
-		fmt.Fprintf(&b, "package %v\n\n", *pkgName)
+	var b bytes.Buffer
+	fmt.Fprintln(&b, `// Code generated by 'interfacer'; DO NOT EDIT.`)
+	fmt.Fprintf(&b, "package %v\n\n", pkgName)
+	if decl := im.Decl(); decl != nil {
+		format.Node(&b, token.NewFileSet(), decl)
+		b.WriteString("\n\n")
+	}
+	b.Write(decl.Bytes())
 
-		for _, p := range impast.DefaultImporter.Loaded() {
-			fmt.Fprintf(&b, "import %q\n", p)
-		}
-		printer.Fprint(&b, token.NewFileSet(), decl)
+	src, err := imports.Process("", b.Bytes(), &imports.Options{
+		Comments: true,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to goimports: %w", err)
+	}
+	return src, nil
+}
 
-		src, err := imports.Process("", b.Bytes(), &imports.Options{
-			Comments: true,
-		})
-		if err != nil {
-			log.Fatalf("failed to goimports: %v", err)
+func writeInterface(w io.Writer, name string, tparams *ast.FieldList, methods []*ast.FuncDecl) {
+	fmt.Fprintf(w, "type %v%v interface {\n", name, typeParamsString(tparams))
+	for _, method := range methods {
+		if method.Doc != nil {
+			for _, c := range method.Doc.List {
+				fmt.Fprintln(w, c.Text)
+			}
 		}
-		os.Stdout.Write(src)
-	} else {
-		printer.Fprint(os.Stdout, token.NewFileSet(), decl)
-		fmt.Println()
+		fmt.Fprintf(w, "%v%v\n", method.Name.Name, strings.TrimPrefix(impast.TypeName(method.Type), "func"))
 	}
+	fmt.Fprint(w, "}")
 }
 
-func intersectionMethods(a, b []*ast.FuncDecl) []*ast.FuncDecl {
+func intersectionMethods(keys *impast.Imports, a, b []*ast.FuncDecl) []*ast.FuncDecl {
 	if a == nil {
 		return b
 	}
 	c := a[:0]
 	for _, x := range a {
-		for len(b) > 0 && less(b[0], x) {
+		for len(b) > 0 && less(keys, b[0], x) {
 			b = b[1:]
 		}
-		if len(b) > 0 && equal(x, b[0]) {
+		if len(b) > 0 && equal(keys, x, b[0]) {
 			c = append(c, x)
 		}
 	}
 	return c
 }
 
-func less(a, b *ast.FuncDecl) bool {
+func less(keys *impast.Imports, a, b *ast.FuncDecl) bool {
 	if a.Name.Name != b.Name.Name {
 		return a.Name.Name < b.Name.Name
 	}
-	return signature(a) < signature(b)
+	return signature(keys, a) < signature(keys, b)
 }
 
-func equal(a, b *ast.FuncDecl) bool {
-	ok := !less(a, b) && !less(b, a)
+func equal(keys *impast.Imports, a, b *ast.FuncDecl) bool {
+	ok := !less(keys, a, b) && !less(keys, b, a)
 	return ok
 }
 
-func signature(f *ast.FuncDecl) string {
-	args := types(f.Type.Params)
-	results := types(f.Type.Results)
+func signature(keys *impast.Imports, f *ast.FuncDecl) string {
+	ft := keys.Qualify(f.Type).(*ast.FuncType)
+	args := types(ft.Params)
+	results := types(ft.Results)
 
 	return fmt.Sprintf("(%s)(%s)", strings.Join(args, ","), strings.Join(results, ","))
 }
@@ -147,3 +253,18 @@ func types(fl *ast.FieldList) []string {
 	}
 	return ts
 }
+
+func typeParamsString(tparams *ast.FieldList) string {
+	if tparams == nil || len(tparams.List) == 0 {
+		return ""
+	}
+	params := make([]string, 0, len(tparams.List))
+	for _, field := range tparams.List {
+		names := make([]string, 0, len(field.Names))
+		for _, name := range field.Names {
+			names = append(names, name.Name)
+		}
+		params = append(params, strings.Join(names, ", ")+" "+impast.TypeName(field.Type))
+	}
+	return "[" + strings.Join(params, ", ") + "]"
+}
@@ -0,0 +1,187 @@
+package main
+
+import (
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"testing"
+
+	"github.com/orisano/impast"
+)
+
+func TestGenerate(t *testing.T) {
+	parse := func(filename, src string) *ast.File {
+		f, err := parser.ParseFile(token.NewFileSet(), filename, src, 0)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return f
+	}
+	pkg := func(name, src string) *ast.Package {
+		return &ast.Package{Name: name, Files: map[string]*ast.File{name + ".go": parse(name+".go", src)}}
+	}
+	pkgs := map[string]*ast.Package{
+		"example.com/cache": pkg("cache", `
+package cache
+
+type Cache[K comparable, V any] struct{}
+
+func (c *Cache[K, V]) Get(key K) (V, bool) {
+	var v V
+	return v, false
+}
+
+func (c *Cache[_, V]) Put(item Item[V]) {}
+
+type Item[T any] struct{}
+`),
+		"myapp/a": pkg("a", `
+package a
+
+import bb "myapp/b"
+
+type A struct{}
+
+func (A) Get() bb.Thing { return bb.Thing{} }
+
+func (A) Close() error { return nil }
+`),
+		"myapp/b": pkg("b", `
+package b
+
+type Thing struct{}
+`),
+		"myapp/c": pkg("c", `
+package c
+
+import "myapp/b"
+
+type C struct{}
+
+func (C) Get() b.Thing { return b.Thing{} }
+`),
+		"myapp/p": pkg("p", `
+package p
+
+import "myapp/x/log"
+
+type P struct{}
+
+func (P) L() log.Logger { return nil }
+
+func (P) Name() string { return "" }
+`),
+		"myapp/q": pkg("q", `
+package q
+
+import "myapp/y/log"
+
+type Q struct{}
+
+func (Q) L() log.Logger { return nil }
+
+func (Q) Name() string { return "" }
+`),
+		"myapp/x/log": pkg("log", `
+package log
+
+type Logger interface{}
+`),
+		"myapp/y/log": pkg("log", `
+package log
+
+type Logger interface{}
+`),
+	}
+	imp := &impast.Importer{EnableCache: true}
+	imp.Load(pkgs)
+
+	tests := []struct {
+		types    []string
+		pkgName  string
+		expected string
+	}{
+		{
+			types: []string{"example.com/cache.Cache"},
+			expected: `type I[K comparable, V any] interface {
+	Get(key K) (V, bool)
+	Put(item cache.Item[V])
+}
+`,
+		},
+		{
+			types:   []string{"example.com/cache.Cache"},
+			pkgName: "x",
+			expected: `// Code generated by 'interfacer'; DO NOT EDIT.
+package x
+
+import (
+	"example.com/cache"
+)
+
+type I[K comparable, V any] interface {
+	Get(key K) (V, bool)
+	Put(item cache.Item[V])
+}
+`,
+		},
+		{
+			types:   []string{"myapp/a.A"},
+			pkgName: "x",
+			expected: `// Code generated by 'interfacer'; DO NOT EDIT.
+package x
+
+import (
+	"myapp/b"
+)
+
+type I interface {
+	Close() error
+	Get() b.Thing
+}
+`,
+		},
+		{
+			types:   []string{"myapp/a.A", "myapp/c.C"},
+			pkgName: "x",
+			expected: `// Code generated by 'interfacer'; DO NOT EDIT.
+package x
+
+import (
+	"myapp/b"
+)
+
+type I interface {
+	Get() b.Thing
+}
+`,
+		},
+		{
+			types:   []string{"myapp/p.P", "myapp/q.Q"},
+			pkgName: "x",
+			expected: `// Code generated by 'interfacer'; DO NOT EDIT.
+package x
+
+type I interface {
+	Name() string
+}
+`,
+		},
+	}
+	for _, test := range tests {
+		var im impast.Imports
+		methods, tparams, err := lookupMethods(imp, &im, test.types, true)
+		if err != nil {
+			t.Errorf("failed to lookup methods %v: %v", test.types, err)
+			continue
+		}
+		src, err := generate("I", test.pkgName, "", &im, tparams, methods)
+		if err != nil {
+			t.Errorf("failed to generate %v(pkg=%q): %v", test.types, test.pkgName, err)
+			continue
+		}
+		if string(src) != test.expected {
+			t.Errorf("unexpected source %v(pkg=%q). expected:\n%v\nbut got:\n%v", test.types, test.pkgName, test.expected, string(src))
+		}
+	}
+}
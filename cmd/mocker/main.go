@@ -1,12 +1,18 @@
 package main
 
 import (
+	"bytes"
 	"flag"
+	"fmt"
 	"go/ast"
+	"go/build"
+	"go/parser"
 	"go/printer"
 	"go/token"
+	"io"
 	"log"
 	"os"
+	"strings"
 
 	"github.com/orisano/impast"
 )
@@ -14,23 +20,96 @@ import (
 func main() {
 	pkgPath := flag.String("pkg", "", "package path")
 	interfaceName := flag.String("type", "", "interface type")
+	dir := flag.String("dir", "", "directory to resolve imports from")
+	tags := flag.String("tags", "", "comma-separated list of build tags")
+	cache := flag.Bool("cache", false, "cache parsed packages on disk")
+	comments := flag.Bool("comments", false, "copy method documentation")
+	overlay := flag.String("overlay", "", "JSON file in the go build -overlay format")
+	tests := flag.Bool("tests", false, "include in-package _test.go files")
+	localPath := flag.String("local", "", "import path of the package to generate into")
 	flag.Parse()
 
+	impast.DefaultImporter.EnableCache = true
+	impast.DefaultImporter.Dir = *dir
+	impast.DefaultImporter.Tests = *tests
+	if *tags != "" {
+		ctx := build.Default
+		ctx.BuildTags = strings.Split(*tags, ",")
+		impast.DefaultImporter.Context = &ctx
+	}
+	if *overlay != "" {
+		m, err := impast.ReadOverlay(*overlay)
+		if err != nil {
+			log.Fatalf("failed to read overlay: %v", err)
+		}
+		impast.DefaultImporter.Overlay = m
+	}
+	if *comments {
+		impast.DefaultImporter.Mode = parser.ParseComments
+	}
+	if *cache {
+		cacheDir, err := impast.DefaultCacheDir()
+		if err != nil {
+			log.Fatalf("failed to get cache dir: %v", err)
+		}
+		impast.DefaultImporter.CacheDir = cacheDir
+	}
+
 	pkg, err := impast.ImportPackage(*pkgPath)
 	if err != nil {
 		log.Fatal(err)
 	}
 
-	it := impast.FindInterface(pkg, *interfaceName)
-	if it == nil {
-		log.Fatalf("interface not found %q", *interfaceName)
+	var local string
+	if *localPath != "" {
+		p, err := impast.ImportPackage(*localPath)
+		if err != nil {
+			log.Fatal(err)
+		}
+		local, _ = impast.DefaultImporter.ImportPath(p)
+	}
+
+	src, err := generate(&impast.DefaultImporter, pkg, *interfaceName, local)
+	if err != nil {
+		log.Fatal(err)
+	}
+	os.Stdout.Write(src)
+}
+
+// generate returns the mock of the interface name of pkg with the import declaration it needs.
+// The mock is written into the package of the import path local if it is not empty.
+func generate(imp *impast.Importer, pkg *ast.Package, name string, local string) ([]byte, error) {
+	typeSpec, typeFile := imp.FindTypeSpec(pkg, name)
+	if typeSpec == nil {
+		return nil, fmt.Errorf("interface not found %q", name)
+	}
+	basePkg, file, underlying, err := imp.Underlying(pkg, name)
+	if err != nil {
+		return nil, fmt.Errorf("failed to resolve %v.%v: %w", pkg.Name, name, err)
+	}
+	it, ok := underlying.(*ast.InterfaceType)
+	if !ok {
+		return nil, fmt.Errorf("%q is not interface", name)
 	}
 
-	mockName := ast.NewIdent(*interfaceName + "Mock")
+	var im impast.Imports
+	mockName := ast.NewIdent(name + "Mock")
 	st := &ast.StructType{Fields: &ast.FieldList{}}
-	methods := impast.GetRequires(it)
-	for i := range methods {
-		methods[i].Type = impast.ExportType(pkg, methods[i].Type)
+	methods, err := imp.GetRequires(basePkg, file, it)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get requires %v.%v: %w", pkg.Name, name, err)
+	}
+	for i, method := range methods {
+		// the fields belong to the parsed package.
+		m := *method
+		m.Type, err = imp.ExportGenericTypeTo(&im, basePkg, file, typeSpec.TypeParams, m.Type)
+		if err != nil {
+			return nil, fmt.Errorf("failed to export %v.%v: %w", pkg.Name, name, err)
+		}
+		if local != "" {
+			m.Type = im.Localize(local, m.Type)
+		}
+		methods[i] = &m
 	}
 	for _, method := range methods {
 		st.Fields.List = append(st.Fields.List, &ast.Field{
@@ -38,26 +117,56 @@ func main() {
 			Type:  method.Type,
 		})
 	}
+	tparams, err := imp.ExportTypeParamsTo(&im, pkg, typeFile, typeSpec.TypeParams)
+	if err != nil {
+		return nil, fmt.Errorf("failed to export type parameters of %v.%v: %w", pkg.Name, name, err)
+	}
+	if local != "" {
+		tparams = im.LocalizeFields(local, tparams)
+	}
 	genDecl := &ast.GenDecl{
 		Tok: token.TYPE,
 		Specs: []ast.Spec{&ast.TypeSpec{
-			Type: st,
-			Name: mockName,
+			Type:       st,
+			Name:       mockName,
+			TypeParams: tparams,
 		}},
 	}
-	printer.Fprint(os.Stdout, token.NewFileSet(), genDecl)
-	os.Stdout.WriteString("\n\n")
+
+	var b bytes.Buffer
+	if decl := im.Decl(); decl != nil {
+		printer.Fprint(&b, token.NewFileSet(), decl)
+		b.WriteString("\n\n")
+	}
+	printer.Fprint(&b, token.NewFileSet(), genDecl)
+	b.WriteString("\n\n")
 
 	recvName := ast.NewIdent("mo")
+	recvType := instantiate(mockName, typeSpec.TypeParams)
 
 	for _, method := range methods {
-		funcDecl := genMockFuncDecl(mockName, recvName, method)
-		printer.Fprint(os.Stdout, token.NewFileSet(), funcDecl)
-		os.Stdout.WriteString("\n\n")
+		funcDecl := genMockFuncDecl(recvType, recvName, method)
+		writeDoc(&b, method.Doc)
+		printer.Fprint(&b, token.NewFileSet(), funcDecl)
+		b.WriteString("\n\n")
 	}
+	return b.Bytes(), nil
 }
 
-func genMockFuncDecl(mock, recv *ast.Ident, method *ast.Field) *ast.FuncDecl {
+func instantiate(name *ast.Ident, tparams *ast.FieldList) ast.Expr {
+	if tparams == nil {
+		return name
+	}
+	var args []ast.Expr
+	for _, field := range tparams.List {
+		for _, n := range field.Names {
+			args = append(args, ast.NewIdent(n.Name))
+		}
+	}
+	return &ast.IndexListExpr{X: name, Indices: args}
+}
+
+func genMockFuncDecl(mock ast.Expr, recv *ast.Ident, method *ast.Field) *ast.FuncDecl {
 	ft := impast.AutoNaming(method.Type.(*ast.FuncType))
 	expr := &ast.CallExpr{
 		Fun:  &ast.SelectorExpr{X: recv, Sel: ast.NewIdent(method.Names[0].Name + "Mock")},
@@ -98,3 +207,12 @@ func flattenName(fields *ast.FieldList) []ast.Expr {
 	}
 	return names
 }
+
+func writeDoc(w io.Writer, doc *ast.CommentGroup) {
+	if doc == nil {
+		return
+	}
+	for _, c := range doc.List {
+		fmt.Fprintln(w, c.Text)
+	}
+}
@@ -0,0 +1,109 @@
+package main
+
+import (
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"testing"
+
+	"github.com/orisano/impast"
+)
+
+func TestGenerate(t *testing.T) {
+	parse := func(filename, src string) *ast.File {
+		f, err := parser.ParseFile(token.NewFileSet(), filename, src, 0)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return f
+	}
+	pkgs := map[string]*ast.Package{
+		"probe/a": {Name: "a", Files: map[string]*ast.File{"a.go": parse("a.go", `
+package a
+
+import (
+	oa "other/a"
+	bb "probe/b"
+)
+
+type Local struct{}
+
+type Getter[T any] interface {
+	Get(key T) (bb.Thing, *Local)
+	Other() oa.Other
+}
+`)}},
+		"other/a": {Name: "a", Files: map[string]*ast.File{"a.go": parse("a.go", `
+package a
+
+type Other struct{}
+`)}},
+		"probe/b": {Name: "b", Files: map[string]*ast.File{"b.go": parse("b.go", `
+package b
+
+type Thing struct{}
+`)}},
+	}
+	imp := &impast.Importer{EnableCache: true}
+	imp.Load(pkgs)
+
+	tests := []struct {
+		local    string
+		expected string
+	}{
+		{
+			expected: `import (
+	a2 "other/a"
+	"probe/a"
+	"probe/b"
+)
+
+type GetterMock[T any] struct {
+	GetMock		func(key T) (b.Thing, *a.Local)
+	OtherMock	func() a2.Other
+}
+
+func (mo *GetterMock[T]) Get(key T) (b.Thing, *a.Local) {
+	return mo.GetMock(key)
+}
+
+func (mo *GetterMock[T]) Other() a2.Other {
+	return mo.OtherMock()
+}
+
+`,
+		},
+		{
+			local: "probe/a",
+			expected: `import (
+	a2 "other/a"
+	"probe/b"
+)
+
+type GetterMock[T any] struct {
+	GetMock		func(key T) (b.Thing, *Local)
+	OtherMock	func() a2.Other
+}
+
+func (mo *GetterMock[T]) Get(key T) (b.Thing, *Local) {
+	return mo.GetMock(key)
+}
+
+func (mo *GetterMock[T]) Other() a2.Other {
+	return mo.OtherMock()
+}
+
+`,
+		},
+	}
+	for _, test := range tests {
+		src, err := generate(imp, pkgs["probe/a"], "Getter", test.local)
+		if err != nil {
+			t.Errorf("failed to generate(local=%q): %v", test.local, err)
+			continue
+		}
+		if string(src) != test.expected {
+			t.Errorf("unexpected source(local=%q). expected:\n%v\nbut got:\n%v", test.local, test.expected, string(src))
+		}
+	}
+}
@@ -1,13 +1,18 @@
 package main
 
 import (
+	"bytes"
 	"flag"
+	"fmt"
 	"go/ast"
+	"go/build"
 	"go/parser"
 	"go/printer"
 	"go/token"
+	"io"
 	"log"
 	"os"
+	"strings"
 
 	"github.com/orisano/impast"
 )
@@ -18,16 +23,98 @@ func main() {
 	typeName := flag.String("type", "", "type name")
 	receiverName := flag.String("name", "", "receiver name")
 	export := flag.Bool("export", false, "export")
+	dir := flag.String("dir", "", "directory to resolve imports from")
+	tags := flag.String("tags", "", "comma-separated list of build tags")
+	cache := flag.Bool("cache", false, "cache parsed packages on disk")
+	comments := flag.Bool("comments", false, "copy method documentation")
+	overlay := flag.String("overlay", "", "JSON file in the go build -overlay format")
+	tests := flag.Bool("tests", false, "include in-package _test.go files")
+	localPath := flag.String("local", "", "import path of the package to generate into")
 	flag.Parse()
 
+	impast.DefaultImporter.EnableCache = true
+	impast.DefaultImporter.Dir = *dir
+	impast.DefaultImporter.Tests = *tests
+	if *tags != "" {
+		ctx := build.Default
+		ctx.BuildTags = strings.Split(*tags, ",")
+		impast.DefaultImporter.Context = &ctx
+	}
+	if *overlay != "" {
+		m, err := impast.ReadOverlay(*overlay)
+		if err != nil {
+			log.Fatalf("failed to read overlay: %v", err)
+		}
+		impast.DefaultImporter.Overlay = m
+	}
+	if *comments {
+		impast.DefaultImporter.Mode = parser.ParseComments
+	}
+	if *cache {
+		cacheDir, err := impast.DefaultCacheDir()
+		if err != nil {
+			log.Fatalf("failed to get cache dir: %v", err)
+		}
+		impast.DefaultImporter.CacheDir = cacheDir
+	}
+
 	pkg, err := impast.ImportPackage(*pkgPath)
 	if err != nil {
 		log.Fatal(err)
 	}
 
-	it := impast.FindInterface(pkg, *interfaceName)
-	if it == nil {
-		log.Fatalf("interface not found %q", *interfaceName)
+	var local string
+	if *localPath != "" {
+		p, err := impast.ImportPackage(*localPath)
+		if err != nil {
+			log.Fatal(err)
+		}
+		local, _ = impast.DefaultImporter.ImportPath(p)
+	}
+
+	src, err := generate(&impast.DefaultImporter, pkg, *interfaceName, *typeName, *receiverName, *export, local)
+	if err != nil {
+		log.Fatal(err)
+	}
+	os.Stdout.Write(src)
+}
+
+// generate returns the stubs of the methods of the interface name of pkg for the receiver
+// recvName of typeName, with the import declaration they need. The stubs are written into
+// the package of the import path local, or into pkg unless export is set.
+func generate(imp *impast.Importer, pkg *ast.Package, name, typeName, recvName string, export bool, local string) ([]byte, error) {
+	typeSpec, _ := imp.FindTypeSpec(pkg, name)
+	if typeSpec == nil {
+		return nil, fmt.Errorf("interface not found %q", name)
+	}
+	basePkg, file, underlying, err := imp.Underlying(pkg, name)
+	if err != nil {
+		return nil, fmt.Errorf("failed to resolve %v.%v: %w", pkg.Name, name, err)
+	}
+	it, ok := underlying.(*ast.InterfaceType)
+	if !ok {
+		return nil, fmt.Errorf("%q is not interface", name)
+	}
+	methods, err := imp.GetRequires(basePkg, file, it)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get requires %v.%v: %w", pkg.Name, name, err)
+	}
+	if local == "" && !export {
+		local, ok = imp.ImportPath(pkg)
+		if !ok {
+			return nil, fmt.Errorf("package %v is not loaded", pkg.Name)
+		}
+	}
+
+	recvType := typeName
+	if typeSpec.TypeParams != nil && !strings.Contains(recvType, "[") {
+		var names []string
+		for _, field := range typeSpec.TypeParams.List {
+			for _, n := range field.Names {
+				names = append(names, n.Name)
+			}
+		}
+		recvType += "[" + strings.Join(names, ", ") + "]"
 	}
 
 	body, err := parser.ParseExpr(`panic("implement me")`)
@@ -35,17 +122,22 @@ func main() {
 		panic(err)
 	}
 
-	for _, method := range impast.GetRequires(it) {
-		t := method.Type
-		if *export {
-			t = impast.ExportType(pkg, t)
+	var im impast.Imports
+	var decls bytes.Buffer
+	for _, method := range methods {
+		t, err := imp.ExportGenericTypeTo(&im, basePkg, file, typeSpec.TypeParams, method.Type)
+		if err != nil {
+			return nil, fmt.Errorf("failed to export %v.%v: %w", pkg.Name, name, err)
+		}
+		if local != "" {
+			t = im.Localize(local, t)
 		}
 		decl := &ast.FuncDecl{
 			Name: method.Names[0],
 			Recv: &ast.FieldList{List: []*ast.Field{
 				{
-					Names: []*ast.Ident{ast.NewIdent(*receiverName)},
-					Type:  ast.NewIdent(*typeName),
+					Names: []*ast.Ident{ast.NewIdent(recvName)},
+					Type:  ast.NewIdent(recvType),
 				},
 			}},
 			Type: impast.AutoNaming(t.(*ast.FuncType)),
@@ -53,7 +145,25 @@ func main() {
 				&ast.ExprStmt{X: body},
 			}},
 		}
-		printer.Fprint(os.Stdout, token.NewFileSet(), decl)
-		os.Stdout.WriteString("\n\n")
+		writeDoc(&decls, method.Doc)
+		printer.Fprint(&decls, token.NewFileSet(), decl)
+		decls.WriteString("\n\n")
+	}
+
+	var b bytes.Buffer
+	if decl := im.Decl(); decl != nil {
+		printer.Fprint(&b, token.NewFileSet(), decl)
+		b.WriteString("\n\n")
+	}
+	b.Write(decls.Bytes())
+	return b.Bytes(), nil
+}
+
+func writeDoc(w io.Writer, doc *ast.CommentGroup) {
+	if doc == nil {
+		return
+	}
+	for _, c := range doc.List {
+		fmt.Fprintln(w, c.Text)
 	}
 }
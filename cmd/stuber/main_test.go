@@ -0,0 +1,89 @@
+package main
+
+import (
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"testing"
+
+	"github.com/orisano/impast"
+)
+
+func TestGenerate(t *testing.T) {
+	parse := func(filename, src string) *ast.File {
+		f, err := parser.ParseFile(token.NewFileSet(), filename, src, 0)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return f
+	}
+	pkgs := map[string]*ast.Package{
+		"probe/a": {Name: "a", Files: map[string]*ast.File{"a.go": parse("a.go", `
+package a
+
+import bb "probe/b"
+
+type Local struct{}
+
+type Getter[T any] interface {
+	Get(key T) (bb.Thing, *Local)
+	Close() error
+}
+`)}},
+		"probe/b": {Name: "b", Files: map[string]*ast.File{"b.go": parse("b.go", `
+package b
+
+type Thing struct{}
+`)}},
+	}
+	imp := &impast.Importer{EnableCache: true}
+	imp.Load(pkgs)
+
+	tests := []struct {
+		export   bool
+		expected string
+	}{
+		{
+			expected: `import (
+	"probe/b"
+)
+
+func (s S[T]) Get(key T) (b.Thing, *Local) {
+	panic("implement me")
+}
+
+func (s S[T]) Close() error {
+	panic("implement me")
+}
+
+`,
+		},
+		{
+			export: true,
+			expected: `import (
+	"probe/a"
+	"probe/b"
+)
+
+func (s S[T]) Get(key T) (b.Thing, *a.Local) {
+	panic("implement me")
+}
+
+func (s S[T]) Close() error {
+	panic("implement me")
+}
+
+`,
+		},
+	}
+	for _, test := range tests {
+		src, err := generate(imp, pkgs["probe/a"], "Getter", "S", "s", test.export, "")
+		if err != nil {
+			t.Errorf("failed to generate(export=%v): %v", test.export, err)
+			continue
+		}
+		if string(src) != test.expected {
+			t.Errorf("unexpected source(export=%v). expected:\n%v\nbut got:\n%v", test.export, test.expected, string(src))
+		}
+	}
+}
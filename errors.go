@@ -0,0 +1,111 @@
+package impast
+
+import (
+	"errors"
+	"fmt"
+	"go/ast"
+	"go/token"
+	"strings"
+)
+
+var (
+	PackageNotFound = errors.New("package not found")
+	TypeNotFound    = errors.New("type not found")
+)
+
+type PackageNotFoundError struct {
+	Path string
+	Dir  string
+}
+
+func (e *PackageNotFoundError) Error() string {
+	if e.Dir == "" {
+		return fmt.Sprintf("package not found: %v", e.Path)
+	}
+	return fmt.Sprintf("package not found: %v in %v", e.Path, e.Dir)
+}
+
+func (e *PackageNotFoundError) Is(target error) bool {
+	return target == PackageNotFound
+}
+
+// TypeNotFoundError reports a missing type. Pos is the position of the reference to it,
+// if the type was referred to from a file parsed by the importer.
+type TypeNotFoundError struct {
+	Pos     token.Position
+	Package string
+	Name    string
+}
+
+func (e *TypeNotFoundError) Error() string {
+	if e.Package == "" {
+		return withPos(e.Pos, fmt.Sprintf("type not found: %v", e.Name))
+	}
+	return withPos(e.Pos, fmt.Sprintf("type not found: %v.%v", e.Package, e.Name))
+}
+
+func (e *TypeNotFoundError) Is(target error) bool {
+	return target == TypeNotFound
+}
+
+type NotInterfaceError struct {
+	Pos  token.Position
+	Name string
+	Kind string
+}
+
+func (e *NotInterfaceError) Error() string {
+	return withPos(e.Pos, fmt.Sprintf("%v is not interface: %v", e.Name, e.Kind))
+}
+
+// RecursiveTypeError reports a type that refers to itself without indirection.
+// Pos is the position of its declaration.
+type RecursiveTypeError struct {
+	Pos  token.Position
+	Name string
+}
+
+func (e *RecursiveTypeError) Error() string {
+	return withPos(e.Pos, fmt.Sprintf("invalid recursive type %v", e.Name))
+}
+
+type AmbiguousPackageError struct {
+	Dir   string
+	Names []string
+}
+
+func (e *AmbiguousPackageError) Error() string {
+	return fmt.Sprintf("ambiguous packages in %q, found %v", e.Dir, strings.Join(e.Names, ", "))
+}
+
+func withPos(pos token.Position, msg string) string {
+	if !pos.IsValid() {
+		return msg
+	}
+	return pos.String() + ": " + msg
+}
+
+// kindOf describes a type expression for diagnostics.
+func kindOf(expr ast.Expr) string {
+	switch t := expr.(type) {
+	case *ast.StructType:
+		return "struct"
+	case *ast.InterfaceType:
+		return "interface"
+	case *ast.FuncType:
+		return "func"
+	case *ast.MapType:
+		return "map"
+	case *ast.ChanType:
+		return "chan"
+	case *ast.StarExpr:
+		return "pointer"
+	case *ast.ArrayType:
+		if t.Len == nil {
+			return "slice"
+		}
+		return "array"
+	default:
+		return TypeName(expr)
+	}
+}
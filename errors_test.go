@@ -0,0 +1,120 @@
+package impast_test
+
+import (
+	"errors"
+	"go/ast"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/orisano/impast"
+)
+
+func TestErrors(t *testing.T) {
+	dir := t.TempDir()
+	writeFiles(t, dir, map[string]string{
+		"go.mod": "module example.com/m\n",
+		"foo/foo.go": `package foo
+
+import "example.com/m/missing"
+
+type Foo struct {
+	missing.Missing
+}
+`,
+		"iface/iface.go": `package iface
+
+import "example.com/m/iface/bar"
+
+type I interface {
+	bar.S
+}
+`,
+		"iface/bar/bar.go": "package bar\n\ntype S struct{}\n",
+		"amb/a.go":         "package a\n",
+		"amb/b.go":         "package b\n",
+		"amb/c_test.go":    "package c_test\n",
+		"doc/doc.go":       "package documentation\n",
+		"rec/rec.go":       "package rec\n\ntype T struct {\n\tT\n}\n\ntype A = B\n\ntype B = A\n\ntype E struct {\n\tUnknown\n}\n",
+		"doc/x_test.go":    "package x_test\n",
+	})
+
+	imp := &impast.Importer{Dir: dir}
+	pkg, err := imp.ImportPackage("./foo")
+	if err != nil {
+		t.Fatalf("failed to import: %v", err)
+	}
+
+	_, err = imp.GetMethodsDeep(pkg, "Qux")
+	var typeErr *impast.TypeNotFoundError
+	if !errors.Is(err, impast.TypeNotFound) || !errors.As(err, &typeErr) {
+		t.Fatalf("expected TypeNotFoundError, but got: %v", err)
+	}
+	if typeErr.Package != "example.com/m/foo" || typeErr.Name != "Qux" {
+		t.Errorf("unexpected error: %+v", typeErr)
+	}
+
+	_, err = imp.GetMethodsDeep(pkg, "Foo")
+	if !errors.Is(err, impast.PackageNotFound) {
+		t.Errorf("expected PackageNotFound, but got: %v", err)
+	}
+
+	ipkg, err := imp.ImportPackage("./iface")
+	if err != nil {
+		t.Fatalf("failed to import: %v", err)
+	}
+	spec, f := impast.FindTypeSpec(ipkg, "I")
+	_, err = imp.GetRequires(ipkg, f, spec.Type.(*ast.InterfaceType))
+	var ifaceErr *impast.NotInterfaceError
+	if !errors.As(err, &ifaceErr) {
+		t.Fatalf("expected NotInterfaceError, but got: %v", err)
+	}
+	if ifaceErr.Name != "bar.S" || ifaceErr.Kind != "struct" || filepath.Base(ifaceErr.Pos.Filename) != "bar.go" || ifaceErr.Pos.Line != 3 {
+		t.Errorf("unexpected error: %+v", ifaceErr)
+	}
+
+	rpkg, err := imp.ImportPackage("./rec")
+	if err != nil {
+		t.Fatalf("failed to import: %v", err)
+	}
+	for name, line := range map[string]int{"T": 3, "A": 7} {
+		_, _, _, err := imp.Underlying(rpkg, name)
+		if name == "T" {
+			_, err = imp.GetMethodsDeep(rpkg, name)
+		}
+		var recErr *impast.RecursiveTypeError
+		if !errors.As(err, &recErr) {
+			t.Errorf("expected RecursiveTypeError for %v, but got: %v", name, err)
+			continue
+		}
+		if recErr.Name != name || filepath.Base(recErr.Pos.Filename) != "rec.go" || recErr.Pos.Line != line {
+			t.Errorf("unexpected error: %+v", recErr)
+		}
+	}
+	_, err = imp.GetMethodsDeep(rpkg, "E")
+	if !errors.As(err, &typeErr) {
+		t.Fatalf("expected TypeNotFoundError, but got: %v", err)
+	}
+	if typeErr.Name != "Unknown" || typeErr.Pos.Line != 12 || typeErr.Pos.Column != 2 {
+		t.Errorf("unexpected error: %+v", typeErr)
+	}
+
+	_, err = imp.ImportPackage("./amb")
+	var ambErr *impast.AmbiguousPackageError
+	if !errors.As(err, &ambErr) {
+		t.Fatalf("expected AmbiguousPackageError, but got: %v", err)
+	}
+	if expected := []string{"a", "b"}; !reflect.DeepEqual(ambErr.Names, expected) {
+		t.Errorf("unexpected names. expected: %v, but got: %v", expected, ambErr.Names)
+	}
+
+	imp.Tests = true
+	_, err = imp.ImportPackage("./doc")
+	var notFoundErr *impast.PackageNotFoundError
+	if !errors.As(err, &notFoundErr) {
+		t.Fatalf("expected PackageNotFoundError, but got: %v", err)
+	}
+	if notFoundErr.Path != "example.com/m/doc" {
+		t.Errorf("unexpected error: %+v", notFoundErr)
+	}
+}
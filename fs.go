@@ -0,0 +1,188 @@
+package impast
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"go/build"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+)
+
+type overlayInfo struct {
+	name string
+	size int64
+}
+
+func (fi overlayInfo) Name() string       { return fi.name }
+func (fi overlayInfo) Size() int64        { return fi.size }
+func (fi overlayInfo) Mode() fs.FileMode  { return 0o444 }
+func (fi overlayInfo) ModTime() time.Time { return time.Time{} }
+func (fi overlayInfo) IsDir() bool        { return false }
+func (fi overlayInfo) Sys() interface{}   { return nil }
+
+// ReadOverlay reads an overlay file in the format accepted by go build -overlay.
+func ReadOverlay(filename string) (map[string][]byte, error) {
+	data, err := os.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+	var ov struct {
+		Replace map[string]string
+	}
+	if err := json.Unmarshal(data, &ov); err != nil {
+		return nil, fmt.Errorf("parse overlay %v: %w", filename, err)
+	}
+	overlay := map[string][]byte{}
+	for name, replacement := range ov.Replace {
+		src, err := os.ReadFile(replacement)
+		if err != nil {
+			return nil, fmt.Errorf("read overlay %v: %w", name, err)
+		}
+		overlay[name] = src
+	}
+	return overlay, nil
+}
+
+func fsName(name string) string {
+	return filepath.ToSlash(filepath.Clean(name))
+}
+
+func (i *Importer) abs(name string) string {
+	if i.FS != nil {
+		return filepath.Clean(name)
+	}
+	if abs, err := filepath.Abs(name); err == nil {
+		return abs
+	}
+	return filepath.Clean(name)
+}
+
+func (i *Importer) overlay(name string) ([]byte, bool) {
+	if len(i.Overlay) == 0 {
+		return nil, false
+	}
+	name = i.abs(name)
+	for k, src := range i.Overlay {
+		if i.abs(k) == name {
+			return src, true
+		}
+	}
+	return nil, false
+}
+
+// useFS reports whether name is read from FS. The standard library and the module cache
+// are always read from the host file system, so that their packages resolve in FS mode.
+func (i *Importer) useFS(name string) bool {
+	if i.FS == nil {
+		return false
+	}
+	if !filepath.IsAbs(name) {
+		return true
+	}
+	ctx := i.buildContext()
+	for _, root := range []string{ctx.GOROOT, modCacheRoot(ctx)} {
+		if _, ok := hasSubdir(root, name); root != "" && ok {
+			return false
+		}
+	}
+	return true
+}
+
+func (i *Importer) readFile(name string) ([]byte, error) {
+	if src, ok := i.overlay(name); ok {
+		return src, nil
+	}
+	if i.useFS(name) {
+		return fs.ReadFile(i.FS, fsName(name))
+	}
+	return os.ReadFile(name)
+}
+
+func (i *Importer) stat(name string) (fs.FileInfo, error) {
+	if src, ok := i.overlay(name); ok {
+		return overlayInfo{name: filepath.Base(name), size: int64(len(src))}, nil
+	}
+	if i.useFS(name) {
+		return fs.Stat(i.FS, fsName(name))
+	}
+	return os.Stat(name)
+}
+
+func (i *Importer) isFile(name string) bool {
+	fi, err := i.stat(name)
+	return err == nil && !fi.IsDir()
+}
+
+func (i *Importer) isDir(name string) bool {
+	if fi, err := i.stat(name); err == nil {
+		return fi.IsDir()
+	}
+	name = i.abs(name)
+	for k := range i.Overlay {
+		if _, ok := hasSubdir(name, i.abs(k)); ok {
+			return true
+		}
+	}
+	return false
+}
+
+func (i *Importer) readDirInfos(dir string) ([]fs.FileInfo, error) {
+	var entries []fs.DirEntry
+	var err error
+	if i.useFS(dir) {
+		entries, err = fs.ReadDir(i.FS, fsName(dir))
+	} else {
+		entries, err = os.ReadDir(dir)
+	}
+	if err != nil && !i.isDir(dir) {
+		return nil, err
+	}
+
+	var infos []fs.FileInfo
+	seen := map[string]bool{}
+	absDir := i.abs(dir)
+	for k, src := range i.Overlay {
+		if name := i.abs(k); filepath.Dir(name) == absDir {
+			infos = append(infos, overlayInfo{name: filepath.Base(name), size: int64(len(src))})
+			seen[filepath.Base(name)] = true
+		}
+	}
+	for _, entry := range entries {
+		if seen[entry.Name()] {
+			continue
+		}
+		info, err := entry.Info()
+		if err != nil {
+			continue
+		}
+		infos = append(infos, info)
+	}
+	sort.Slice(infos, func(i, j int) bool {
+		return infos[i].Name() < infos[j].Name()
+	})
+	return infos, nil
+}
+
+// context returns the build context whose file access goes through FS and Overlay.
+func (i *Importer) context() *build.Context {
+	ctx := i.buildContext()
+	if i.FS == nil && len(i.Overlay) == 0 {
+		return ctx
+	}
+	c := *ctx
+	c.IsDir = i.isDir
+	c.ReadDir = i.readDirInfos
+	c.OpenFile = func(name string) (io.ReadCloser, error) {
+		src, err := i.readFile(name)
+		if err != nil {
+			return nil, err
+		}
+		return io.NopCloser(bytes.NewReader(src)), nil
+	}
+	return &c
+}
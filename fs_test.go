@@ -0,0 +1,135 @@
+package impast_test
+
+import (
+	"go/ast"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"testing/fstest"
+
+	"github.com/orisano/impast"
+)
+
+func methodNames(methods []*ast.FuncDecl) []string {
+	var names []string
+	for _, m := range methods {
+		names = append(names, m.Name.Name)
+	}
+	return names
+}
+
+func TestImporter_FS(t *testing.T) {
+	fsys := fstest.MapFS{
+		"go.mod": {Data: []byte("module example.com/m\n")},
+		"foo/foo.go": {Data: []byte(`package foo
+
+import (
+	"io"
+
+	"example.com/m/bar"
+)
+
+type Foo struct {
+	bar.Bar
+	io.Reader
+}
+
+func (f *Foo) Do() {}
+`)},
+		"bar/bar.go": {Data: []byte(`package bar
+
+type Bar struct{}
+
+func (b Bar) Run() {}
+`)},
+		"bar/bar_test.go": {Data: []byte(`package bar
+
+func (b Bar) Test() {}
+`)},
+	}
+
+	for _, importPath := range []string{"example.com/m/foo", "./foo"} {
+		imp := &impast.Importer{FS: fsys}
+		pkg, err := imp.ImportPackage(importPath)
+		if err != nil {
+			t.Errorf("failed to import(%v): %v", importPath, err)
+			continue
+		}
+		methods, err := imp.GetMethodsDeep(pkg, "Foo")
+		if err != nil {
+			t.Errorf("failed to get methods(%v): %v", importPath, err)
+			continue
+		}
+		if got, expected := methodNames(methods), []string{"Do", "Read", "Run"}; !reflect.DeepEqual(got, expected) {
+			t.Errorf("unexpected methods(%v). expected: %v, but got: %v", importPath, expected, got)
+		}
+	}
+
+	imp := &impast.Importer{FS: fsys}
+	if _, err := imp.ImportPackage("example.com/m/baz"); err == nil {
+		t.Error("expected error for missing package")
+	}
+}
+
+func TestImporter_Overlay(t *testing.T) {
+	dir := t.TempDir()
+	writeFiles(t, dir, map[string]string{
+		"go.mod": "module example.com/m\n",
+		"foo/foo.go": `package foo
+
+type Foo struct{}
+
+func (f *Foo) Do() {}
+`,
+	})
+
+	imp := &impast.Importer{
+		EnableCache: true,
+		Revalidate:  true,
+		Dir:         dir,
+		Overlay: map[string][]byte{
+			filepath.Join(dir, "foo", "foo.go"): []byte(`package foo
+
+import "example.com/m/bar"
+
+type Foo struct {
+	bar.Bar
+}
+
+func (f *Foo) Do() {}
+
+func (f *Foo) Undo() {}
+`),
+			filepath.Join(dir, "bar", "bar.go"): []byte(`package bar
+
+type Bar struct{}
+
+func (b Bar) Run() {}
+`),
+		},
+	}
+	pkg, err := imp.ImportPackage("example.com/m/foo")
+	if err != nil {
+		t.Fatalf("failed to import: %v", err)
+	}
+	methods, err := imp.GetMethodsDeep(pkg, "Foo")
+	if err != nil {
+		t.Fatalf("failed to get methods: %v", err)
+	}
+	if got, expected := methodNames(methods), []string{"Do", "Run", "Undo"}; !reflect.DeepEqual(got, expected) {
+		t.Errorf("unexpected methods. expected: %v, but got: %v", expected, got)
+	}
+
+	if imp.Stale("example.com/m/bar") {
+		t.Error("expected fresh cache")
+	}
+	imp.Overlay[filepath.Join(dir, "bar", "bar.go")] = []byte(`package bar
+
+type Bar struct{}
+
+func (b Bar) Ran() {}
+`)
+	if !imp.Stale("example.com/m/bar") {
+		t.Error("expected stale cache after overlay change")
+	}
+}
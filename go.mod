@@ -2,9 +2,8 @@ module github.com/orisano/impast
 
 go 1.26.2
 
-require golang.org/x/tools v0.48.0
-
 require (
-	golang.org/x/mod v0.38.0 // indirect
-	golang.org/x/sync v0.22.0 // indirect
+	golang.org/x/mod v0.38.0
+	golang.org/x/sync v0.22.0
+	golang.org/x/tools v0.48.0
 )
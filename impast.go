@@ -2,162 +2,534 @@ package impast
 
 import (
 	"bytes"
-	"errors"
+	"crypto/sha256"
 	"fmt"
 	"go/ast"
 	"go/build"
 	"go/parser"
 	"go/printer"
 	"go/token"
+	"go/types"
+	"io/fs"
 	"os"
+	"path"
+	"path/filepath"
+	"runtime"
 	"sort"
 	"strconv"
 	"strings"
 	"sync"
-)
+	"time"
+	"unicode"
+	"weak"
 
-var (
-	PackageNotFound = errors.New("package not found")
-	TypeNotFound    = errors.New("type not found")
+	"golang.org/x/sync/errgroup"
+	"golang.org/x/sync/singleflight"
 )
 
 func ignoreTestFile(info os.FileInfo) bool {
-	return !strings.HasSuffix(info.Name(), "_test.go")
+	return !IsTestFile(info.Name())
+}
+
+func IsTestFile(filename string) bool {
+	return strings.HasSuffix(filename, "_test.go")
+}
+
+func isTestPackage(name string) bool {
+	return strings.HasSuffix(name, "_test")
 }
 
 type Importer struct {
 	EnableCache bool
+	Dir         string
+	Context     *build.Context
+	TypeCheck   bool
+	CacheDir    string
+	Revalidate  bool
+	Concurrency int
+	Mode        parser.Mode
+	FS          fs.FS
+	Overlay     map[string][]byte
+	Tests       bool
 	cache       sync.Map
+	group       singleflight.Group
+	files       sync.Map // weak.Pointer[ast.File] -> *pkgInfo
+	packages    sync.Map // weak.Pointer[ast.Package] -> *pkgInfo
+	indexes     sync.Map // weak.Pointer[ast.Package] -> *Index
+	typesPkgs   sync.Map
+	fset        *token.FileSet
+	fsetOnce    sync.Once
+	workers     chan struct{}
+	workersOnce sync.Once
+	roots       sync.Map
+}
+
+type pkgInfo struct {
+	pkg  weak.Pointer[ast.Package]
+	path string
+	dir  string
+	// parsed reports whether files were parsed with the importer's FileSet.
+	parsed bool
 }
 
 var DefaultImporter Importer
 
 func (i *Importer) Load(pkgs map[string]*ast.Package) {
 	for p, pkg := range pkgs {
-		i.cache.Store(p, pkg)
+		i.cache.Store(p, &cacheEntry{pkg: pkg, importPath: p, path: p, loadedAt: time.Now()})
+		i.register(pkg, p, "", false)
+	}
+}
+
+// register records pkg and its files by weak references, so that packages which are not
+// cached are dropped along with the last reference to them.
+func (i *Importer) register(pkg *ast.Package, pkgPath, dir string, parsed bool) {
+	key := weak.Make(pkg)
+	info := &pkgInfo{pkg: key, path: pkgPath, dir: dir, parsed: parsed}
+	i.packages.Store(key, info)
+	i.indexes.Store(key, newIndex(pkg))
+	runtime.AddCleanup(pkg, i.unregister, key)
+	for _, f := range pkg.Files {
+		fkey := weak.Make(f)
+		i.files.Store(fkey, info)
+		runtime.AddCleanup(f, i.unregisterFile, fkey)
+		if parsed {
+			if tf := i.FileSet().File(f.Pos()); tf != nil {
+				runtime.AddCleanup(f, i.FileSet().RemoveFile, tf)
+			}
+		}
+	}
+}
+
+func (i *Importer) unregister(key weak.Pointer[ast.Package]) {
+	i.packages.Delete(key)
+	i.indexes.Delete(key)
+}
+
+func (i *Importer) unregisterFile(key weak.Pointer[ast.File]) {
+	i.files.Delete(key)
+}
+
+// removeFile drops f, parsed by the importer, from its FileSet.
+func (i *Importer) removeFile(f *ast.File) {
+	if tf := i.FileSet().File(f.Pos()); tf != nil {
+		i.FileSet().RemoveFile(tf)
+	}
+}
+
+func (i *Importer) loadedPackage(pkg *ast.Package) (*pkgInfo, bool) {
+	v, ok := i.packages.Load(weak.Make(pkg))
+	if !ok {
+		return nil, false
+	}
+	return v.(*pkgInfo), true
+}
+
+func (i *Importer) loadedFile(f *ast.File) (*pkgInfo, bool) {
+	v, ok := i.files.Load(weak.Make(f))
+	if !ok {
+		return nil, false
+	}
+	return v.(*pkgInfo), true
+}
+
+// filePackage returns the package of f, or nil if f was not loaded by the importer.
+func (i *Importer) filePackage(f *ast.File) *ast.Package {
+	if info, ok := i.loadedFile(f); ok {
+		return info.pkg.Value()
+	}
+	return nil
+}
+
+func (i *Importer) FileSet() *token.FileSet {
+	i.fsetOnce.Do(func() {
+		i.fset = token.NewFileSet()
+	})
+	return i.fset
+}
+
+func (i *Importer) Position(pos token.Pos) token.Position {
+	return i.FileSet().Position(pos)
+}
+
+// position returns the position of node if f was parsed by the importer.
+func (i *Importer) position(f *ast.File, node ast.Node) token.Position {
+	info, ok := i.loadedFile(f)
+	if !ok || !info.parsed || node == nil {
+		return token.Position{}
+	}
+	return i.Position(node.Pos())
+}
+
+func (i *Importer) pkgPath(pkg *ast.Package) string {
+	if info, ok := i.loadedPackage(pkg); ok {
+		return info.path
 	}
+	return pkg.Name
+}
+
+func (i *Importer) buildContext() *build.Context {
+	if i.Context != nil {
+		return i.Context
+	}
+	return &build.Default
+}
+
+func (i *Importer) matchFile(dir string, info os.FileInfo, tests bool) bool {
+	if info.IsDir() || !strings.HasSuffix(info.Name(), ".go") || (!tests && !ignoreTestFile(info)) {
+		return false
+	}
+	ok, err := i.context().MatchFile(dir, info.Name())
+	return err == nil && ok
+}
+
+func (i *Importer) srcDir(f *ast.File) string {
+	if info, ok := i.loadedFile(f); ok && info.dir != "" {
+		return info.dir
+	}
+	if i.Dir != "" {
+		return i.Dir
+	}
+	return "."
 }
 
 func (i *Importer) Loaded() []string {
 	var paths []string
-	i.cache.Range(func(key, _ interface{}) bool {
-		paths = append(paths, key.(string))
+	seen := map[string]bool{}
+	i.cache.Range(func(_, value interface{}) bool {
+		if p := value.(*cacheEntry).importPath; !seen[p] {
+			seen[p] = true
+			paths = append(paths, p)
+		}
 		return true
 	})
 	return paths
 }
 
 func (i *Importer) ImportPackage(importPath string) (*ast.Package, error) {
-	if i.EnableCache {
-		if v, ok := i.cache.Load(importPath); ok {
-			return v.(*ast.Package), nil
+	return i.ImportFrom(importPath, i.srcDir(nil))
+}
+
+func (i *Importer) ImportFrom(importPath, srcDir string) (*ast.Package, error) {
+	return i.importFrom(importPath, srcDir, "")
+}
+
+// ImportPackageName imports the package named name from the directory of importPath.
+// External test packages are selected by their name, e.g. "foo_test".
+func (i *Importer) ImportPackageName(importPath, name string) (*ast.Package, error) {
+	return i.importFrom(importPath, i.srcDir(nil), name)
+}
+
+func (i *Importer) ImportTestPackage(importPath string) (*ast.Package, error) {
+	pkg, err := i.ImportPackage(importPath)
+	if err != nil {
+		return nil, err
+	}
+	return i.ImportPackageName(importPath, pkg.Name+"_test")
+}
+
+func (i *Importer) importFrom(importPath, srcDir, name string) (*ast.Package, error) {
+	ref := importPath
+	if build.IsLocalImport(importPath) {
+		ref = filepath.Join(srcDir, importPath)
+	}
+	key := ref
+	if name != "" {
+		key += "#" + name
+	}
+	// an import path resolves to different packages in different modules, except for the
+	// packages given to Load.
+	if _, loaded := i.cache.Load(key); !loaded && !build.IsLocalImport(importPath) {
+		key += "@" + i.moduleRoot(srcDir)
+	}
+	if pkg, ok := i.lookup(key); ok {
+		return pkg, nil
+	}
+	v, err, _ := i.group.Do(key, func() (interface{}, error) {
+		if pkg, ok := i.lookup(key); ok {
+			return pkg, nil
 		}
+		return i.importPackage(importPath, srcDir, name, ref, key)
+	})
+	if err != nil {
+		return nil, err
 	}
-	pkg, err := build.Import(importPath, ".", build.FindOnly)
+	return v.(*ast.Package), nil
+}
+
+func (i *Importer) lookup(key string) (*ast.Package, bool) {
+	if !i.EnableCache {
+		return nil, false
+	}
+	v, ok := i.cache.Load(key)
+	if !ok {
+		return nil, false
+	}
+	e := v.(*cacheEntry)
+	if i.Revalidate && i.stale(e) {
+		i.forget(key, e)
+		return nil, false
+	}
+	return e.pkg, true
+}
+
+func (i *Importer) importPackage(importPath, srcDir, name, ref, key string) (*ast.Package, error) {
+	pkgPath, canonicalPath, err := i.findPackage(importPath, srcDir)
 	if err != nil {
 		return nil, fmt.Errorf("import: %w", err)
 	}
 
-	pkgPath := pkg.Dir
-	fset := token.NewFileSet()
-	astPkgs, err := parser.ParseDir(fset, pkgPath, ignoreTestFile, 0)
+	tests := i.Tests || isTestPackage(name)
+	srcs, stamps, err := i.readDir(pkgPath, tests)
+	if err != nil {
+		return nil, fmt.Errorf("read package %q: %w", pkgPath, err)
+	}
+	astPkgs, err := i.parsePackages(srcs)
 	if err != nil {
 		return nil, fmt.Errorf("parse package %q: %w", pkgPath, err)
 	}
-	if len(astPkgs) > 1 {
-		delete(astPkgs, "main")
+	var pkg *ast.Package
+	if name != "" {
+		var ok bool
+		if pkg, ok = astPkgs[name]; !ok {
+			return nil, &PackageNotFoundError{Path: name, Dir: pkgPath}
+		}
+		if isTestPackage(name) {
+			canonicalPath += "_test"
+		}
+	} else if pkg, err = selectPackage(astPkgs, canonicalPath, pkgPath); err != nil {
+		return nil, err
 	}
-	if len(astPkgs) != 1 {
-		return nil, fmt.Errorf("ambiguous packages, found %d packages", len(astPkgs))
+
+	i.register(pkg, canonicalPath, pkgPath, true)
+	if i.EnableCache {
+		i.cache.Store(key, &cacheEntry{
+			pkg:        pkg,
+			importPath: ref,
+			path:       canonicalPath,
+			dir:        pkgPath,
+			tests:      tests,
+			stamps:     stamps,
+			loadedAt:   time.Now(),
+		})
 	}
-	for _, pkg := range astPkgs {
-		if i.EnableCache {
-			i.cache.Store(importPath, pkg)
+	return pkg, nil
+}
+
+// selectPackage picks the package of a directory the way the go command would see it:
+// documentation and external test packages are ignored, the package named after the
+// import path is preferred and main is dropped in favor of any other package.
+func selectPackage(pkgs map[string]*ast.Package, canonicalPath, dir string) (*ast.Package, error) {
+	candidates := map[string]*ast.Package{}
+	for name, pkg := range pkgs {
+		if name != "documentation" && !isTestPackage(name) {
+			candidates[name] = pkg
 		}
+	}
+	if len(candidates) == 0 {
+		return nil, &PackageNotFoundError{Path: canonicalPath, Dir: dir}
+	}
+	if len(candidates) > 1 {
+		for _, p := range []string{canonicalPath, filepath.ToSlash(dir)} {
+			if pkg, ok := candidates[assumedPackageName(p)]; ok {
+				return pkg, nil
+			}
+		}
+		delete(candidates, "main")
+	}
+	if len(candidates) != 1 {
+		return nil, &AmbiguousPackageError{Dir: dir, Names: sortedNames(candidates)}
+	}
+	for _, pkg := range candidates {
 		return pkg, nil
 	}
 	return nil, PackageNotFound
 }
 
+func assumedPackageName(importPath string) string {
+	base := path.Base(importPath)
+	if strings.HasPrefix(base, "v") {
+		if _, err := strconv.Atoi(base[1:]); err == nil && path.Dir(importPath) != "." {
+			base = path.Base(path.Dir(importPath))
+		}
+	}
+	base = strings.TrimPrefix(base, "go-")
+	if i := strings.IndexFunc(base, func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r) && r != '_'
+	}); i >= 0 {
+		base = base[:i]
+	}
+	return base
+}
+
+func (i *Importer) readDir(dir string, tests bool) (map[string][]byte, map[string]fileStamp, error) {
+	infos, err := i.readDirInfos(dir)
+	if err != nil {
+		return nil, nil, err
+	}
+	srcs := map[string][]byte{}
+	stamps := map[string]fileStamp{}
+	for _, info := range infos {
+		if !i.matchFile(dir, info, tests) {
+			continue
+		}
+		filename := filepath.Join(dir, info.Name())
+		src, err := i.readFile(filename)
+		if err != nil {
+			return nil, nil, err
+		}
+		srcs[filename] = src
+		stamps[filename] = fileStamp{modTime: info.ModTime(), size: info.Size(), hash: sha256.Sum256(src)}
+	}
+	return srcs, stamps, nil
+}
+
+func (i *Importer) parsePackages(srcs map[string][]byte) (map[string]*ast.Package, error) {
+	files, err := i.parseFiles(srcs)
+	if err != nil {
+		return nil, err
+	}
+	pkgs := map[string]*ast.Package{}
+	for filename, f := range files {
+		name := f.Name.Name
+		pkg, ok := pkgs[name]
+		if !ok {
+			pkg = &ast.Package{Name: name, Files: map[string]*ast.File{}}
+			pkgs[name] = pkg
+		}
+		pkg.Files[filename] = f
+	}
+	return pkgs, nil
+}
+
+func (i *Importer) parseFiles(srcs map[string][]byte) (map[string]*ast.File, error) {
+	if i.CacheDir != "" {
+		if files, ok := i.loadSummary(srcs); ok {
+			return files, nil
+		}
+	}
+	files := map[string]*ast.File{}
+	for _, filename := range sortedNames(srcs) {
+		f, err := parser.ParseFile(i.FileSet(), filename, srcs[filename], i.Mode)
+		if err != nil {
+			return nil, err
+		}
+		files[filename] = f
+	}
+	if i.CacheDir != "" {
+		i.storeSummary(srcs, files)
+	}
+	return files, nil
+}
+
+func sortedNames[T any](m map[string]T) []string {
+	names := make([]string, 0, len(m))
+	for name := range m {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
 func ImportPackage(importPath string) (*ast.Package, error) {
 	return DefaultImporter.ImportPackage(importPath)
 }
 
+func ImportFrom(importPath, srcDir string) (*ast.Package, error) {
+	return DefaultImporter.ImportFrom(importPath, srcDir)
+}
+
+func ImportPackageName(importPath, name string) (*ast.Package, error) {
+	return DefaultImporter.ImportPackageName(importPath, name)
+}
+
+func ImportTestPackage(importPath string) (*ast.Package, error) {
+	return DefaultImporter.ImportTestPackage(importPath)
+}
+
 func ScanDecl(pkg *ast.Package, f func(ast.Decl) bool) {
-	for _, file := range pkg.Files {
-		for _, decl := range file.Decls {
+	if idx, ok := DefaultImporter.index(pkg); ok {
+		for _, decl := range idx.Decls() {
 			if !f(decl) {
 				return
 			}
 		}
+		return
 	}
+	scanDecls(pkg, func(_ *ast.File, decl ast.Decl) bool {
+		return f(decl)
+	})
 }
 
 func ExportType(pkg *ast.Package, expr ast.Expr) ast.Expr {
-	switch expr := expr.(type) {
-	case *ast.Ident:
-		if !expr.IsExported() {
-			return expr
-		}
-		return &ast.SelectorExpr{Sel: expr, X: ast.NewIdent(pkg.Name)}
-	case *ast.StarExpr:
-		return &ast.StarExpr{X: ExportType(pkg, expr.X)}
-	case *ast.ArrayType:
-		return &ast.ArrayType{Elt: ExportType(pkg, expr.Elt), Len: expr.Len}
-	case *ast.MapType:
-		return &ast.MapType{Key: ExportType(pkg, expr.Key), Value: ExportType(pkg, expr.Value)}
-	case *ast.ChanType:
-		return &ast.ChanType{Begin: expr.Begin, Arrow: expr.Arrow, Dir: expr.Dir, Value: ExportType(pkg, expr.Value)}
-	case *ast.FuncType:
-		fn := *expr
-		fn.Params = ExportFields(pkg, fn.Params)
-		fn.Results = ExportFields(pkg, fn.Results)
-		return &fn
-	case *ast.InterfaceType:
-		it := *expr
-		it.Methods = ExportFields(pkg, it.Methods)
-		return &it
-	case *ast.Ellipsis:
-		return &ast.Ellipsis{Ellipsis: expr.Ellipsis, Elt: ExportType(pkg, expr.Elt)}
-	default:
-		return expr
+	return exportType(pkg, expr, nil)
+}
+
+func identity(id *ast.Ident) ast.Expr {
+	return id
+}
+
+func unqualify(qualifier string) func(*ast.SelectorExpr) ast.Expr {
+	return func(se *ast.SelectorExpr) ast.Expr {
+		if x, ok := se.X.(*ast.Ident); ok && x.Name == qualifier {
+			return ast.NewIdent(se.Sel.Name)
+		}
+		return se
 	}
 }
 
 func ExportFields(pkg *ast.Package, fields *ast.FieldList) *ast.FieldList {
-	if fields == nil {
-		return nil
-	}
-	efields := *fields
-	for i, field := range efields.List {
-		efields.List[i].Type = ExportType(pkg, field.Type)
-	}
-	return &efields
+	return mapFields(fields, func(id *ast.Ident) ast.Expr {
+		return qualify(pkg, id, nil)
+	})
 }
 
 func ExportFunc(pkg *ast.Package, fn *ast.FuncDecl) *ast.FuncDecl {
 	efn := *fn
 	efn.Recv = nil
-	efn.Type = ExportType(pkg, efn.Type).(*ast.FuncType)
+	efn.Type = exportType(pkg, efn.Type, recvTypeParamNames(fn)).(*ast.FuncType)
 	return &efn
 }
 
-func GetMethods(pkg *ast.Package, name string) []*ast.FuncDecl {
-	var methods []*ast.FuncDecl
-	ScanDecl(pkg, func(decl ast.Decl) bool {
-		funcDecl, ok := decl.(*ast.FuncDecl)
-		if !ok {
-			return true
+func (i *Importer) exportMethod(pkg *ast.Package, f *ast.File, fn *ast.FuncDecl, tparams *ast.FieldList) *ast.FuncDecl {
+	names := typeParamNames(tparams)
+	m := map[string]ast.Expr{}
+	for k, arg := range typeArgs(fn.Recv.List[0].Type) {
+		id, ok := arg.(*ast.Ident)
+		if !ok || k >= len(names) || id.Name == "_" || id.Name == names[k] {
+			continue
 		}
-		if funcDecl.Recv == nil {
+		m[id.Name] = ast.NewIdent(names[k])
+	}
+	efn := *substituteFunc(fn, m)
+	efn.Recv = nil
+	efn.Type = i.exportTypeIn(pkg, f, efn.Type, names).(*ast.FuncType)
+	return &efn
+}
+
+func GetMethods(pkg *ast.Package, name string) []*ast.FuncDecl {
+	base := strings.TrimPrefix(name, "*")
+	var decls []*ast.FuncDecl
+	if idx, ok := DefaultImporter.index(pkg); ok {
+		decls = idx.Methods(base)
+	} else {
+		scanDecls(pkg, func(_ *ast.File, decl ast.Decl) bool {
+			if d, ok := decl.(*ast.FuncDecl); ok && d.Recv != nil && len(d.Recv.List) > 0 {
+				if id, ok := baseType(d.Recv.List[0].Type).(*ast.Ident); ok && id.Name == base {
+					decls = append(decls, d)
+				}
+			}
 			return true
-		}
+		})
+	}
+
+	var methods []*ast.FuncDecl
+	for _, funcDecl := range decls {
 		rt := funcDecl.Recv.List[0]
-		if TypeName(rt.Type) == name && funcDecl.Name.IsExported() {
+		if TypeName(stripTypeArgs(rt.Type)) == name && funcDecl.Name.IsExported() {
 			methods = append(methods, funcDecl)
 		}
-		return true
-	})
+	}
 	return methods
 }
 
@@ -166,63 +538,194 @@ func GetMethodsDeep(pkg *ast.Package, name string) ([]*ast.FuncDecl, error) {
 }
 
 func (i *Importer) GetMethodsDeep(pkg *ast.Package, name string) ([]*ast.FuncDecl, error) {
-	var t *ast.StructType
+	return i.GetMethodSet(pkg, name, true)
+}
 
-	m := map[string]*ast.FuncDecl{}
-	for _, f := range pkg.Files {
-		for _, decl := range f.Decls {
-			switch d := decl.(type) {
-			case *ast.FuncDecl:
-				if isOwnMethod(name, d) && d.Name.IsExported() {
-					m[d.Name.Name] = d
-				}
-			case *ast.GenDecl:
-				if t != nil {
-					continue
-				}
-				st, found, err := findStruct(d, name)
-				if err != nil {
-					return nil, fmt.Errorf("find struct(%+v): %w", d, err)
-				}
-				if !found {
-					continue
-				}
-				t = st
-				if err := i.resolveMethodsDeep(pkg, f, t, m); err != nil {
-					return nil, fmt.Errorf("resolve methods: %w", err)
-				}
-			}
+func GetMethodSet(pkg *ast.Package, name string, pointer bool) ([]*ast.FuncDecl, error) {
+	return DefaultImporter.GetMethodSet(pkg, name, pointer)
+}
+
+// GetMethodSet returns the exported method set of name, or of *name if pointer is set.
+func (i *Importer) GetMethodSet(pkg *ast.Package, name string, pointer bool) ([]*ast.FuncDecl, error) {
+	ms, err := i.LookupMethodSet(pkg, name, pointer)
+	if err != nil {
+		return nil, err
+	}
+	return ms.Methods, nil
+}
+
+type MethodSet struct {
+	Methods []*ast.FuncDecl
+	// Ambiguous lists the promoted methods excluded because several of them
+	// are found at the shallowest depth.
+	Ambiguous []string
+}
+
+func LookupMethodSet(pkg *ast.Package, name string, pointer bool) (*MethodSet, error) {
+	return DefaultImporter.LookupMethodSet(pkg, name, pointer)
+}
+
+func (i *Importer) LookupMethodSet(pkg *ast.Package, name string, pointer bool) (*MethodSet, error) {
+	sels, _, err := i.methodsDeep(pkg, name, pointer, nil)
+	if err != nil {
+		return nil, err
+	}
+	ms := &MethodSet{}
+	for _, key := range sortedNames(sels) {
+		sel := sels[key]
+		if sel.fn == nil || !ast.IsExported(key) {
+			continue
+		}
+		if sel.count > 1 {
+			ms.Ambiguous = append(ms.Ambiguous, key)
+		} else {
+			ms.Methods = append(ms.Methods, sel.fn)
 		}
 	}
-	if t == nil {
-		return nil, TypeNotFound
+	return ms, nil
+}
+
+// selection is the shallowest field or method reachable by a selector.
+type selection struct {
+	// fn is nil if no method of the method set is found at depth.
+	fn    *ast.FuncDecl
+	depth int
+	count int
+}
+
+func addSelection(sels map[string]selection, name string, sel selection) {
+	cur, ok := sels[name]
+	switch {
+	case !ok || sel.depth < cur.depth:
+		sels[name] = sel
+	case sel.depth == cur.depth:
+		cur.count += sel.count
+		if cur.fn == nil {
+			cur.fn = sel.fn
+		}
+		sels[name] = cur
 	}
-	methods := make([]*ast.FuncDecl, 0, len(m))
-	for _, f := range m {
-		methods = append(methods, ExportFunc(pkg, f))
+}
+
+// embedPath is the chain of types being expanded, innermost first.
+type embedPath struct {
+	pkg    *ast.Package
+	name   string
+	ptr    bool // the next type is embedded through a pointer
+	parent *embedPath
+}
+
+// cycle reports whether name is already being expanded, and whether the cycle
+// goes through a pointer, which makes it a valid type.
+func (p *embedPath) cycle(pkg *ast.Package, name string) (found, ptr bool) {
+	for ; p != nil; p = p.parent {
+		ptr = ptr || p.ptr
+		if p.pkg == pkg && p.name == name {
+			return true, ptr
+		}
 	}
-	sort.Slice(methods, func(i, j int) bool {
-		return methods[i].Name.Name < methods[j].Name.Name
-	})
-	return methods, nil
+	return false, false
 }
 
-func findStruct(d *ast.GenDecl, name string) (*ast.StructType, bool, error) {
-	if d.Tok != token.TYPE {
-		return nil, false, nil
+func (i *Importer) methodsDeep(pkg *ast.Package, name string, pointer bool, path *embedPath) (map[string]selection, *ast.FieldList, error) {
+	idx := i.IndexPackage(pkg)
+	typeSpec, f := idx.Type(name)
+	if typeSpec == nil {
+		return nil, nil, &TypeNotFoundError{Package: i.pkgPath(pkg), Name: name}
 	}
-	for _, spec := range d.Specs {
-		typeSpec := spec.(*ast.TypeSpec)
-		if typeSpec.Name.Name != name {
-			continue
+	if found, ptr := path.cycle(pkg, name); found {
+		if !ptr {
+			return nil, nil, &RecursiveTypeError{Pos: i.position(f, typeSpec), Name: name}
 		}
-		st, ok := typeSpec.Type.(*ast.StructType)
+		// every method reachable again is already found at a shallower depth.
+		return map[string]selection{}, nil, nil
+	}
+	path = &embedPath{pkg: pkg, name: name, parent: path}
+	scope := typeParamNames(typeSpec.TypeParams)
+	if _, _, ok := namedType(typeSpec.Type); ok && typeSpec.Assign.IsValid() {
+		// an alias denotes the very same type, including its methods.
+		sels, tparams, err := i.getEmbeddedMethods(pkg, f, typeSpec.Type, pointer, path)
+		if err != nil {
+			return nil, nil, fmt.Errorf("resolve alias(%v): %w", name, err)
+		}
+		return i.instantiateSelections(pkg, f, sels, tparams, typeArgs(typeSpec.Type), scope), typeSpec.TypeParams, nil
+	}
+
+	// a defined type only keeps the methods promoted through its underlying struct or interface.
+	ref, err := i.follow(pkg, f, typeSpec, true)
+	if err != nil {
+		return nil, nil, fmt.Errorf("resolve underlying(%v): %w", name, err)
+	}
+	if it, ok := ref.expr.(*ast.InterfaceType); ok {
+		sels, err := i.requiredMethods(ref.pkg, ref.file, it, scope)
+		if err != nil {
+			return nil, nil, fmt.Errorf("get requires(%v): %w", name, err)
+		}
+		return sels, typeSpec.TypeParams, nil
+	}
+
+	sels := map[string]selection{}
+	for _, d := range idx.Methods(name) {
+		sel := selection{count: 1}
+		if _, ptr := d.Recv.List[0].Type.(*ast.StarExpr); !ptr || pointer {
+			sel.fn = i.exportMethod(pkg, idx.File(d), d, typeSpec.TypeParams)
+		}
+		addSelection(sels, d.Name.Name, sel)
+	}
+	st, ok := ref.expr.(*ast.StructType)
+	if !ok {
+		return sels, typeSpec.TypeParams, nil
+	}
+	for _, field := range st.Fields.List {
+		for _, n := range fieldNames(field) {
+			addSelection(sels, n, selection{count: 1})
+		}
+	}
+	if err := i.resolveMethodsDeep(ref.pkg, ref.file, scope, st, pointer, path, sels); err != nil {
+		return nil, nil, fmt.Errorf("resolve methods: %w", err)
+	}
+	return sels, typeSpec.TypeParams, nil
+}
+
+// requiredMethods returns the methods of an interface, which belong to both method sets.
+func (i *Importer) requiredMethods(pkg *ast.Package, f *ast.File, it *ast.InterfaceType, scope []string) (map[string]selection, error) {
+	requires, err := i.GetRequires(pkg, f, it)
+	if err != nil {
+		return nil, err
+	}
+	sels := make(map[string]selection, len(requires))
+	for _, field := range requires {
+		ft, ok := field.Type.(*ast.FuncType)
 		if !ok {
-			return nil, false, fmt.Errorf("is not struct: %+v", typeSpec.Type)
+			continue
+		}
+		sels[field.Names[0].Name] = selection{
+			fn: &ast.FuncDecl{
+				Doc:  field.Doc,
+				Name: ast.NewIdent(field.Names[0].Name),
+				Type: i.exportTypeIn(pkg, f, ft, scope).(*ast.FuncType),
+			},
+			count: 1,
+		}
+	}
+	return sels, nil
+}
+
+func fieldNames(field *ast.Field) []string {
+	if len(field.Names) == 0 {
+		switch t := baseType(field.Type).(type) {
+		case *ast.Ident:
+			return []string{t.Name}
+		case *ast.SelectorExpr:
+			return []string{t.Sel.Name}
 		}
-		return st, true, nil
+		return nil
+	}
+	names := make([]string, 0, len(field.Names))
+	for _, n := range field.Names {
+		names = append(names, n.Name)
 	}
-	return nil, false, nil
+	return names
 }
 
 func getEmbeddedStruct(s *ast.StructType) []ast.Expr {
@@ -236,32 +739,109 @@ func getEmbeddedStruct(s *ast.StructType) []ast.Expr {
 	return es
 }
 
-func (i *Importer) getEmbeddedMethods(pkg *ast.Package, f *ast.File, t ast.Expr) ([]*ast.FuncDecl, error) {
+func (i *Importer) getEmbeddedMethods(pkg *ast.Package, f *ast.File, t ast.Expr, pointer bool, path *embedPath) (map[string]selection, *ast.FieldList, error) {
+	if id, ok := baseType(t).(*ast.Ident); ok {
+		if typeSpec, _ := i.FindTypeSpec(pkg, id.Name); typeSpec == nil {
+			return nil, nil, &TypeNotFoundError{Pos: i.position(f, t), Package: i.pkgPath(pkg), Name: id.Name}
+		}
+		return i.methodsDeep(pkg, id.Name, pointer, path)
+	}
 	p, name, err := i.ResolveType(f, t)
 	if err != nil {
-		return nil, fmt.Errorf("resolve type: %w", err)
+		return nil, nil, fmt.Errorf("resolve type: %w", err)
 	}
 	if p == nil {
 		p = pkg
 	}
-	return i.GetMethodsDeep(p, name)
+	if typeSpec, _ := i.FindTypeSpec(p, name); typeSpec == nil {
+		return nil, nil, &TypeNotFoundError{Pos: i.position(f, t), Package: i.pkgPath(p), Name: name}
+	}
+	return i.methodsDeep(p, name, pointer, path)
 }
 
-func (i *Importer) resolveMethodsDeep(pkg *ast.Package, f *ast.File, t *ast.StructType, dest map[string]*ast.FuncDecl) error {
-	for _, et := range getEmbeddedStruct(t) {
-		methods, err := i.getEmbeddedMethods(pkg, f, et)
-		if err != nil {
-			return fmt.Errorf("get embedded methods(%v): %w", TypeName(et), err)
-		}
-		for _, method := range methods {
-			if _, ok := dest[method.Name.Name]; !ok {
-				dest[method.Name.Name] = method
+// resolveMethodsDeep collects the methods promoted through the embedded fields of st.
+// Embedding *T promotes the methods of *T even into the method set of the value.
+func (i *Importer) resolveMethodsDeep(pkg *ast.Package, f *ast.File, scope []string, st *ast.StructType, pointer bool, path *embedPath, dest map[string]selection) error {
+	embedded := getEmbeddedStruct(st)
+	results := make([]map[string]selection, len(embedded))
+
+	var eg errgroup.Group
+	for k, et := range embedded {
+		resolve := func() error {
+			_, ptr := et.(*ast.StarExpr)
+			edge := *path
+			edge.ptr = ptr
+			sels, tparams, err := i.getEmbeddedMethods(pkg, f, et, pointer || ptr, &edge)
+			if err != nil {
+				return fmt.Errorf("get embedded methods(%v): %w", TypeName(et), err)
 			}
+			results[k] = i.instantiateSelections(pkg, f, sels, tparams, typeArgs(et), scope)
+			return nil
+		}
+		if i.acquireWorker() {
+			eg.Go(func() error {
+				defer i.releaseWorker()
+				return resolve()
+			})
+			continue
+		}
+		// without a free worker the field is resolved here, so nested fan-outs never wait for one.
+		if err := resolve(); err != nil {
+			eg.Wait()
+			return err
+		}
+	}
+	if err := eg.Wait(); err != nil {
+		return err
+	}
+	for _, sels := range results {
+		for name, sel := range sels {
+			sel.depth++
+			addSelection(dest, name, sel)
 		}
 	}
 	return nil
 }
 
+// acquireWorker reserves one of the Concurrency workers shared by all lookups of the importer.
+func (i *Importer) acquireWorker() bool {
+	i.workersOnce.Do(func() {
+		if i.Concurrency > 0 {
+			i.workers = make(chan struct{}, i.Concurrency)
+		}
+	})
+	select {
+	case i.workers <- struct{}{}:
+		return true
+	default:
+		return false
+	}
+}
+
+func (i *Importer) releaseWorker() {
+	<-i.workers
+}
+
+// instantiateSelections substitutes args, written in f of pkg, for the type parameters of the selected methods.
+func (i *Importer) instantiateSelections(pkg *ast.Package, f *ast.File, sels map[string]selection, tparams *ast.FieldList, args []ast.Expr, scope []string) map[string]selection {
+	exported := make([]ast.Expr, 0, len(args))
+	for _, arg := range args {
+		exported = append(exported, i.exportTypeIn(pkg, f, arg, scope))
+	}
+	sm := typeArgMap(tparams, exported)
+	if len(sm) == 0 {
+		return sels
+	}
+	instances := make(map[string]selection, len(sels))
+	for name, sel := range sels {
+		if sel.fn != nil {
+			sel.fn = substituteFunc(sel.fn, sm)
+		}
+		instances[name] = sel
+	}
+	return instances
+}
+
 func ResolveType(f *ast.File, expr ast.Expr) (*ast.Package, string, error) {
 	return DefaultImporter.ResolveType(f, expr)
 }
@@ -269,9 +849,7 @@ func ResolveType(f *ast.File, expr ast.Expr) (*ast.Package, string, error) {
 func (i *Importer) ResolveType(f *ast.File, expr ast.Expr) (*ast.Package, string, error) {
 	var pkg *ast.Package
 	var err error
-	if se, ok := expr.(*ast.StarExpr); ok {
-		expr = se.X
-	}
+	expr = baseType(expr)
 	if se, ok := expr.(*ast.SelectorExpr); ok {
 		expr = se.Sel
 
@@ -281,10 +859,12 @@ func (i *Importer) ResolveType(f *ast.File, expr ast.Expr) (*ast.Package, string
 			return nil, "", fmt.Errorf("resolve package(%v): %w", se.Sel.Name, err)
 		}
 	} else if id, ok := expr.(*ast.Ident); ok && id.IsExported() {
-		pkg, err = i.ImportPackage(".")
-		wd, _ := os.Getwd()
-		if err != nil {
-			return nil, "", fmt.Errorf("import self package(%v): %w", wd, err)
+		if pkg = i.filePackage(f); pkg == nil {
+			dir := i.srcDir(f)
+			pkg, err = i.ImportFrom(".", dir)
+			if err != nil {
+				return nil, "", fmt.Errorf("import self package(%v): %w", dir, err)
+			}
 		}
 	}
 	name := expr.(*ast.Ident).Name
@@ -303,7 +883,7 @@ func (i *Importer) ResolvePackage(f *ast.File, name string) (*ast.Package, error
 		}
 
 		if imp.Name == nil || imp.Name.Name == name {
-			pkg, err := i.ImportPackage(p)
+			pkg, err := i.ImportFrom(p, i.srcDir(f))
 			if err != nil {
 				return nil, fmt.Errorf("import(%v): %w", p, err)
 			}
@@ -312,41 +892,75 @@ func (i *Importer) ResolvePackage(f *ast.File, name string) (*ast.Package, error
 			}
 		}
 	}
-	return nil, PackageNotFound
+	return nil, &PackageNotFoundError{Path: name, Dir: i.srcDir(f)}
 }
 
-func FindTypeByName(pkg *ast.Package, name string) ast.Expr {
-	var t ast.Expr
-	ScanDecl(pkg, func(decl ast.Decl) bool {
-		genDecl, ok := decl.(*ast.GenDecl)
-		if !ok || genDecl.Tok != token.TYPE {
+func FindTypeSpec(pkg *ast.Package, name string) (*ast.TypeSpec, *ast.File) {
+	return DefaultImporter.FindTypeSpec(pkg, name)
+}
+
+func (i *Importer) FindTypeSpec(pkg *ast.Package, name string) (*ast.TypeSpec, *ast.File) {
+	if idx, ok := i.index(pkg); ok {
+		return idx.Type(name)
+	}
+	var spec *ast.TypeSpec
+	var file *ast.File
+	scanDecls(pkg, func(f *ast.File, decl ast.Decl) bool {
+		d, ok := decl.(*ast.GenDecl)
+		if !ok || d.Tok != token.TYPE {
 			return true
 		}
-		for _, spec := range genDecl.Specs {
-			typeSpec := spec.(*ast.TypeSpec)
-			if typeSpec.Name.Name == name {
-				t = typeSpec.Type
+		for _, s := range d.Specs {
+			if ts := s.(*ast.TypeSpec); ts.Name.Name == name {
+				spec, file = ts, f
 				return false
 			}
 		}
 		return true
 	})
-	return t
+	return spec, file
+}
+
+func FindTypeByName(pkg *ast.Package, name string) ast.Expr {
+	return DefaultImporter.FindTypeByName(pkg, name)
+}
+
+// FindTypeByName returns the type expression of name, following aliases.
+func (i *Importer) FindTypeByName(pkg *ast.Package, name string) ast.Expr {
+	typeSpec, f := i.FindTypeSpec(pkg, name)
+	if typeSpec == nil {
+		return nil
+	}
+	ref, err := i.follow(pkg, f, typeSpec, false)
+	if err != nil {
+		return typeSpec.Type
+	}
+	return ref.expr
 }
 
 func FindInterface(pkg *ast.Package, name string) *ast.InterfaceType {
-	it, ok := FindTypeByName(pkg, name).(*ast.InterfaceType)
-	if !ok {
+	return DefaultImporter.FindInterface(pkg, name)
+}
+
+func (i *Importer) FindInterface(pkg *ast.Package, name string) *ast.InterfaceType {
+	_, _, expr, err := i.Underlying(pkg, name)
+	if err != nil {
 		return nil
 	}
+	it, _ := expr.(*ast.InterfaceType)
 	return it
 }
 
 func FindStruct(pkg *ast.Package, name string) *ast.StructType {
-	st, ok := FindTypeByName(pkg, name).(*ast.StructType)
-	if !ok {
+	return DefaultImporter.FindStruct(pkg, name)
+}
+
+func (i *Importer) FindStruct(pkg *ast.Package, name string) *ast.StructType {
+	_, _, expr, err := i.Underlying(pkg, name)
+	if err != nil {
 		return nil
 	}
+	st, _ := expr.(*ast.StructType)
 	return st
 }
 
@@ -374,7 +988,19 @@ func GetRequires(it *ast.InterfaceType) []*ast.Field {
 
 	for _, field := range it.Methods.List {
 		if len(field.Names) == 0 {
-			for _, f := range GetRequires(field.Type.(*ast.Ident).Obj.Decl.(*ast.TypeSpec).Type.(*ast.InterfaceType)) {
+			id, ok := field.Type.(*ast.Ident)
+			if !ok || id.Obj == nil {
+				continue
+			}
+			typeSpec, ok := id.Obj.Decl.(*ast.TypeSpec)
+			if !ok {
+				continue
+			}
+			embedded, ok := typeSpec.Type.(*ast.InterfaceType)
+			if !ok {
+				continue
+			}
+			for _, f := range GetRequires(embedded) {
 				add(f)
 			}
 		} else {
@@ -384,6 +1010,105 @@ func GetRequires(it *ast.InterfaceType) []*ast.Field {
 	return fields
 }
 
+func (i *Importer) GetRequires(pkg *ast.Package, f *ast.File, it *ast.InterfaceType) ([]*ast.Field, error) {
+	var fields []*ast.Field
+	has := map[string]struct{}{}
+
+	add := func(f *ast.Field) {
+		name := f.Names[0].Name
+		if _, ok := has[name]; ok {
+			return
+		}
+		has[name] = struct{}{}
+		fields = append(fields, f)
+	}
+
+	for _, field := range it.Methods.List {
+		if len(field.Names) > 0 {
+			add(field)
+			continue
+		}
+		embedded, err := i.getEmbeddedRequires(pkg, f, field.Type)
+		if err != nil {
+			return nil, fmt.Errorf("get embedded requires(%v): %w", TypeName(field.Type), err)
+		}
+		for _, ef := range embedded {
+			add(ef)
+		}
+	}
+	return fields, nil
+}
+
+func (i *Importer) getEmbeddedRequires(pkg *ast.Package, f *ast.File, expr ast.Expr) ([]*ast.Field, error) {
+	named, args, ok := namedType(expr)
+	if !ok {
+		// union and approximation elements of type sets have no methods.
+		return nil, nil
+	}
+	id, local := named.(*ast.Ident)
+	if local {
+		if typeSpec, _ := i.FindTypeSpec(pkg, id.Name); typeSpec == nil {
+			return universeRequires(i.position(f, id), id.Name)
+		}
+	}
+	p, file, typeSpec, err := i.lookupNamed(pkg, f, named)
+	if err != nil {
+		return nil, err
+	}
+	ref, err := i.follow(p, file, typeSpec, true)
+	if err != nil {
+		return nil, fmt.Errorf("resolve underlying(%v): %w", TypeName(named), err)
+	}
+	it, ok := ref.expr.(*ast.InterfaceType)
+	if !ok {
+		if local {
+			// a type term of a constraint.
+			return nil, nil
+		}
+		return nil, &NotInterfaceError{Pos: i.position(file, typeSpec), Name: TypeName(named), Kind: kindOf(ref.expr)}
+	}
+	fields, err := i.GetRequires(ref.pkg, ref.file, it)
+	if err != nil {
+		return nil, err
+	}
+	if ref.pkg != pkg || ref.file != f {
+		// the qualifiers written in another file are resolved while its imports are known.
+		exported := make([]*ast.Field, 0, len(fields))
+		for _, field := range fields {
+			ef := *field
+			if ref.pkg != pkg {
+				ef.Type = i.exportTypeIn(ref.pkg, ref.file, field.Type, typeParamNames(typeSpec.TypeParams))
+			} else {
+				ef.Type = mapNames(field.Type, identity, func(se *ast.SelectorExpr) ast.Expr {
+					return i.resolveSelector(ref.file, se)
+				})
+			}
+			exported = append(exported, &ef)
+		}
+		fields = exported
+	}
+	return substituteFields(fields, typeSpec.TypeParams, args), nil
+}
+
+func universeRequires(pos token.Position, name string) ([]*ast.Field, error) {
+	switch name {
+	case "error":
+		return []*ast.Field{{
+			Names: []*ast.Ident{ast.NewIdent("Error")},
+			Type: &ast.FuncType{
+				Params:  &ast.FieldList{},
+				Results: &ast.FieldList{List: []*ast.Field{{Type: ast.NewIdent("string")}}},
+			},
+		}}, nil
+	case "any", "comparable":
+		return nil, nil
+	}
+	if types.Universe.Lookup(name) != nil {
+		return nil, nil
+	}
+	return nil, &TypeNotFoundError{Pos: pos, Name: name}
+}
+
 func AutoNaming(ft *ast.FuncType) *ast.FuncType {
 	t := *ft
 	if len(t.Params.List) == 0 {
@@ -397,14 +1122,3 @@ func AutoNaming(ft *ast.FuncType) *ast.FuncType {
 	}
 	return &t
 }
-
-func isOwnMethod(name string, funcDecl *ast.FuncDecl) bool {
-	if funcDecl.Recv == nil {
-		return false
-	}
-	rt := funcDecl.Recv.List[0].Type
-	if se, ok := rt.(*ast.StarExpr); ok {
-		rt = se.X
-	}
-	return rt.(*ast.Ident).Name == name
-}
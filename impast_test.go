@@ -4,13 +4,16 @@ import (
 	"bytes"
 	"fmt"
 	"go/ast"
+	"go/build"
 	"go/parser"
 	"go/printer"
 	"go/token"
 	"log"
+	"path/filepath"
 	"reflect"
 	"sort"
 	"strings"
+	"sync"
 	"testing"
 
 	"github.com/orisano/impast"
@@ -558,6 +561,23 @@ func (s *S) Bar() {}
 			name:     "*S",
 			expected: []string{"Bar", "Foo"},
 		},
+		{
+			pkg: &ast.Package{
+				Files: map[string]*ast.File{
+					"main.go": mustParseFile(`
+package main
+
+type Cache[K comparable, V any] struct {}
+
+func (c *Cache[K, V]) Get(k K) V { var v V; return v }
+
+func (c Cache[_, _]) Len() int { return 0 }
+`),
+				},
+			},
+			name:     "*Cache",
+			expected: []string{"Get"},
+		},
 	}
 
 	equals := func(a, b []string) bool {
@@ -680,6 +700,21 @@ func TestExportType(t *testing.T) {
 			},
 			expected: "func(opts ...foo.BarOption)",
 		},
+		{
+			pkg:      &ast.Package{Name: "foo"},
+			expr:     mustParseExpr("*List[Item]"),
+			expected: "*foo.List[foo.Item]",
+		},
+		{
+			pkg:      &ast.Package{Name: "foo"},
+			expr:     mustParseExpr("Pair[string, []Item]"),
+			expected: "foo.Pair[string, []foo.Item]",
+		},
+		{
+			pkg:      &ast.Package{Name: "foo"},
+			expr:     mustParseExpr("[Size]byte"),
+			expected: "[foo.Size]byte",
+		},
 	}
 
 	for _, test := range tests {
@@ -1243,6 +1278,66 @@ func (b *Bar) Do(dest interface{}) error {
 
 			expected: []string{"A(string)()", "Do(int)(error)"},
 		},
+		{
+			pkg: &ast.Package{
+				Name: "foo",
+				Files: map[string]*ast.File{
+					"foo.go": mustParseFile(`
+package foo
+
+import (
+	"impast.example/example/bar"
+)
+
+type Cache[K comparable, V any] struct {
+	*bar.List[V]
+	Base[K]
+}
+
+type Base[T any] struct {}
+
+func (b Base[T]) Key() T {
+	var t T
+	return t
+}
+
+func (c *Cache[A, B]) Get(key A) (B, bool) {
+	var v B
+	return v, false
+}
+
+func (c *Cache[_, V]) Put(item Item[V]) {}
+
+type Item[T any] struct{}
+`),
+				},
+			},
+			name: "Cache",
+			pkgs: map[string]*ast.Package{
+				"impast.example/example/bar": {
+					Name: "bar",
+					Files: map[string]*ast.File{
+						"bar.go": mustParseFile(`
+package bar
+
+type List[E any] struct {}
+
+func (l *List[E]) Append(e E) *List[E] {
+	return l
+}
+
+func (l *List[E]) Elem() Elem[E] {
+	return Elem[E]{}
+}
+
+type Elem[E any] struct {}
+`),
+					},
+				},
+			},
+
+			expected: []string{"Append(V)(*bar.List[V])", "Elem()(bar.Elem[V])", "Get(K)(V,bool)", "Key()(K)", "Put(foo.Item[V])()"},
+		},
 	}
 
 	for _, test := range tests {
@@ -1317,3 +1412,877 @@ func TestImporter_Loaded(t *testing.T) {
 		}
 	}
 }
+
+func TestImporter_Context(t *testing.T) {
+	dir := t.TempDir()
+	writeFiles(t, dir, map[string]string{
+		"file.go": `package file
+
+type File struct{}
+`,
+		"file_unix.go": `//go:build unix
+
+package file
+
+func (f *File) Fd() uintptr { return 0 }
+`,
+		"file_windows.go": `package file
+
+func (f *File) Fd() uintptr { return 0 }
+
+func (f *File) Handle() uintptr { return 0 }
+`,
+		"file_cgo.go": `//go:build cgo
+
+package file
+
+import "C"
+
+func (f *File) Cgo() {}
+`,
+		"gen.go": `//go:build ignore
+
+package main
+
+func main() {}
+`,
+		"extra.go": `//go:build extra
+
+package file
+
+func (f *File) Extra() {}
+`,
+	})
+
+	tests := []struct {
+		goos     string
+		cgo      bool
+		tags     []string
+		expected []string
+	}{
+		{goos: "linux", expected: []string{"Fd"}},
+		{goos: "linux", cgo: true, expected: []string{"Cgo", "Fd"}},
+		{goos: "windows", expected: []string{"Fd", "Handle"}},
+		{goos: "darwin", tags: []string{"extra"}, expected: []string{"Extra", "Fd"}},
+	}
+	for _, test := range tests {
+		ctx := build.Default
+		ctx.GOOS = test.goos
+		ctx.CgoEnabled = test.cgo
+		ctx.BuildTags = test.tags
+		imp := &impast.Importer{Context: &ctx}
+		pkg, err := imp.ImportFrom(".", dir)
+		if err != nil {
+			t.Errorf("failed to import(%v): %v", test.goos, err)
+			continue
+		}
+		methods, err := imp.GetMethodsDeep(pkg, "File")
+		if err != nil {
+			t.Errorf("failed to get methods(%v): %v", test.goos, err)
+			continue
+		}
+		var got []string
+		for _, m := range methods {
+			got = append(got, m.Name.Name)
+		}
+		if !reflect.DeepEqual(got, test.expected) {
+			t.Errorf("unexpected methods(%v). expected: %v, but got: %v", test.goos, test.expected, got)
+		}
+	}
+}
+
+func TestImporter_GetRequires(t *testing.T) {
+	pkgs := map[string]*ast.Package{
+		"example.com/foo": {
+			Name: "foo",
+			Files: map[string]*ast.File{
+				"foo.go": mustParseFile(`
+package foo
+
+import (
+	myio "example.com/io"
+)
+
+type Closer interface {
+	Close() error
+}
+
+type ReadCloser interface {
+	myio.Reader
+	Closer
+	error
+}
+
+type Broken interface {
+	myio.Missing
+}
+
+type Getter[K comparable, V any] interface {
+	Get(K) (V, error)
+}
+
+type Store[T any] interface {
+	Getter[string, T]
+	myio.Source[T]
+}
+
+type Reader = myio.Reader
+
+type MyRC interface {
+	Reader
+	Close() error
+}
+
+type LocalR = Closer
+
+type LRC interface {
+	LocalR
+	Flush() error
+}
+
+type DefR myio.Reader
+
+type DRC interface {
+	DefR
+	Closer
+}
+
+type Src[T any] = myio.Source[T]
+
+type AliasStore interface {
+	Src[int]
+}
+
+type Kind int
+
+type Number interface {
+	Kind
+}
+`),
+			},
+		},
+		"example.com/io": {
+			Name: "io",
+			Files: map[string]*ast.File{
+				"io.go": mustParseFile(`
+package io
+
+type Reader interface {
+	Read(p []byte) (n int, err error)
+	Peeker
+}
+
+type Peeker interface {
+	Peek(n int) (Buffer, error)
+}
+
+type Buffer []byte
+
+type Source[E any] interface {
+	Next() (E, Buffer)
+}
+`),
+			},
+		},
+	}
+
+	tests := []struct {
+		name     string
+		expected []string
+		err      bool
+	}{
+		{
+			name:     "ReadCloser",
+			expected: []string{"Close() error", "Error() string", "Peek(n int) (io.Buffer, error)", "Read(p []byte) (n int, err error)"},
+		},
+		{
+			name: "Broken",
+			err:  true,
+		},
+		{
+			name:     "Store",
+			expected: []string{"Get(string) (T, error)", "Next() (T, io.Buffer)"},
+		},
+		{
+			name:     "MyRC",
+			expected: []string{"Close() error", "Peek(n int) (io.Buffer, error)", "Read(p []byte) (n int, err error)"},
+		},
+		{
+			name:     "LRC",
+			expected: []string{"Close() error", "Flush() error"},
+		},
+		{
+			name:     "DRC",
+			expected: []string{"Close() error", "Peek(n int) (io.Buffer, error)", "Read(p []byte) (n int, err error)"},
+		},
+		{
+			name:     "AliasStore",
+			expected: []string{"Next() (int, io.Buffer)"},
+		},
+		{
+			name: "Number",
+		},
+	}
+
+	for _, test := range tests {
+		imp := &impast.Importer{EnableCache: true}
+		imp.Load(pkgs)
+		pkg := pkgs["example.com/foo"]
+
+		typeSpec, file := impast.FindTypeSpec(pkg, test.name)
+		if typeSpec == nil {
+			t.Errorf("type not found: %v", test.name)
+			continue
+		}
+		fields, err := imp.GetRequires(pkg, file, typeSpec.Type.(*ast.InterfaceType))
+		if test.err {
+			if err == nil {
+				t.Errorf("expected error: %v", test.name)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("failed to get requires: %v", err)
+			continue
+		}
+		var got []string
+		for _, field := range fields {
+			got = append(got, field.Names[0].Name+strings.TrimPrefix(impast.TypeName(field.Type), "func"))
+		}
+		sort.Strings(got)
+		if !reflect.DeepEqual(got, test.expected) {
+			t.Errorf("unexpected requires. expected: %v, but got: %v", test.expected, got)
+		}
+	}
+}
+
+func TestImporter_Concurrent(t *testing.T) {
+	dir := t.TempDir()
+	writeFiles(t, dir, map[string]string{
+		"foo/foo.go": `package foo
+
+import (
+	"example.com/bar"
+	"example.com/baz"
+)
+
+type Foo struct {
+	bar.Bar
+	*baz.Baz
+	Qux
+}
+
+type Qux struct{}
+
+func (q Qux) Run() {}
+
+func (f *Foo) Close() error { return nil }
+`,
+	})
+	pkgs := map[string]*ast.Package{
+		"example.com/bar": {
+			Name: "bar",
+			Files: map[string]*ast.File{
+				"bar.go": mustParseFile(`
+package bar
+
+type Bar struct{}
+
+func (b *Bar) Do() {}
+
+func (b *Bar) BarDo() {}
+`),
+			},
+		},
+		"example.com/baz": {
+			Name: "baz",
+			Files: map[string]*ast.File{
+				"baz.go": mustParseFile(`
+package baz
+
+type Baz struct{}
+
+func (b *Baz) BazDo() {}
+
+func (b *Baz) Close() error { return nil }
+`),
+			},
+		},
+	}
+
+	imp := &impast.Importer{EnableCache: true, Concurrency: 4}
+	imp.Load(pkgs)
+
+	const n = 16
+	results := make([]*ast.Package, n)
+	var wg sync.WaitGroup
+	for k := 0; k < n; k++ {
+		wg.Add(1)
+		go func(k int) {
+			defer wg.Done()
+			pkg, err := imp.ImportFrom(".", filepath.Join(dir, "foo"))
+			if err != nil {
+				t.Errorf("failed to import: %v", err)
+				return
+			}
+			results[k] = pkg
+		}(k)
+	}
+	wg.Wait()
+	for _, pkg := range results[1:] {
+		if pkg != results[0] {
+			t.Fatal("concurrent imports should share a single package")
+		}
+	}
+
+	methods, err := imp.GetMethodsDeep(results[0], "Foo")
+	if err != nil {
+		t.Fatalf("failed to get methods: %v", err)
+	}
+	var got []string
+	for _, m := range methods {
+		got = append(got, m.Name.Name)
+	}
+	if expected := []string{"BarDo", "BazDo", "Close", "Do", "Run"}; !reflect.DeepEqual(got, expected) {
+		t.Errorf("unexpected methods. expected: %v, but got: %v", expected, got)
+	}
+}
+
+func TestImporter_Mode(t *testing.T) {
+	dir := t.TempDir()
+	writeFiles(t, dir, map[string]string{
+		"foo.go": `package foo
+
+type Foo struct{}
+
+// Do does something.
+func (f *Foo) Do() {}
+`,
+	})
+
+	imp := &impast.Importer{Mode: parser.ParseComments}
+	pkg, err := imp.ImportFrom(".", dir)
+	if err != nil {
+		t.Fatalf("failed to import: %v", err)
+	}
+	methods, err := imp.GetMethodsDeep(pkg, "Foo")
+	if err != nil {
+		t.Fatalf("failed to get methods: %v", err)
+	}
+	if len(methods) != 1 {
+		t.Fatalf("unexpected methods: %v", len(methods))
+	}
+	if got := methods[0].Doc.Text(); got != "Do does something.\n" {
+		t.Errorf("unexpected doc: %q", got)
+	}
+	pos := imp.Position(methods[0].Name.Pos())
+	if filepath.Base(pos.Filename) != "foo.go" || pos.Line != 6 {
+		t.Errorf("unexpected position: %v", pos)
+	}
+}
+
+func TestImporter_ImportPackageName(t *testing.T) {
+	dir := t.TempDir()
+	writeFiles(t, dir, map[string]string{
+		"go.mod": "module example.com/m\n",
+		"foo/foo.go": `package foo
+
+type Foo struct{}
+`,
+		"foo/doc.go": `package documentation
+`,
+		"foo/gen.go": `//go:build ignore
+
+package gen
+`,
+		"foo/main.go": `package main
+`,
+		"foo/foo_test.go": `package foo
+
+type Test struct{}
+`,
+		"foo/x_test.go": `package foo_test
+
+type X struct{}
+`,
+		"bar/bar.go": `package baz
+`,
+		"bar/tool.go": `package main
+`,
+		"yaml.v2/yaml.go": `package yaml
+`,
+		"yaml.v2/other.go": `package other
+`,
+		"amb/a.go": `package a
+`,
+		"amb/b.go": `package b
+`,
+	})
+
+	tests := []struct {
+		importPath string
+		name       string
+		expected   string
+		err        string
+	}{
+		{importPath: "./foo", expected: "foo"},
+		{importPath: "./foo", name: "main", expected: "main"},
+		{importPath: "./foo", name: "foo_test", expected: "foo_test"},
+		{importPath: "example.com/m/bar", expected: "baz"},
+		{importPath: "example.com/m/yaml.v2", expected: "yaml"},
+		{importPath: "./amb", err: "found a, b"},
+		{importPath: "./foo", name: "gen", err: "package not found"},
+	}
+	imp := &impast.Importer{EnableCache: true, Dir: dir}
+	for _, test := range tests {
+		pkg, err := imp.ImportPackageName(test.importPath, test.name)
+		if test.err != "" {
+			if err == nil || !strings.Contains(err.Error(), test.err) {
+				t.Errorf("expected error(%v, %v): %v, but got: %v", test.importPath, test.name, test.err, err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("failed to import(%v, %v): %v", test.importPath, test.name, err)
+			continue
+		}
+		if pkg.Name != test.expected {
+			t.Errorf("unexpected package(%v, %v). expected: %v, but got: %v", test.importPath, test.name, test.expected, pkg.Name)
+		}
+	}
+
+	pkg, _ := imp.ImportPackage("./foo")
+	if impast.FindTypeByName(pkg, "Test") != nil {
+		t.Error("in-package test files must not be loaded")
+	}
+	xpkg, _ := imp.ImportPackageName("./foo", "foo_test")
+	if impast.FindTypeByName(xpkg, "X") == nil {
+		t.Error("external test package must be loaded")
+	}
+}
+
+func TestImporter_Tests(t *testing.T) {
+	dir := t.TempDir()
+	writeFiles(t, dir, map[string]string{
+		"go.mod": "module example.com/m\n",
+		"foo/foo.go": `package foo
+
+type Foo struct{}
+`,
+		"foo/fake_test.go": `package foo
+
+type Fake interface {
+	Do()
+}
+`,
+		"foo/x_test.go": `package foo_test
+
+type External interface {
+	Run()
+}
+`,
+	})
+
+	imp := &impast.Importer{Dir: dir, Tests: true}
+	pkg, err := imp.ImportPackage("./foo")
+	if err != nil {
+		t.Fatalf("failed to import: %v", err)
+	}
+	if pkg.Name != "foo" {
+		t.Errorf("unexpected package name: %v", pkg.Name)
+	}
+	for _, name := range []string{"Foo", "Fake"} {
+		if impast.FindTypeByName(pkg, name) == nil {
+			t.Errorf("%v must be found", name)
+		}
+	}
+	for filename := range pkg.Files {
+		if impast.IsTestFile(filename) != strings.HasSuffix(filename, "fake_test.go") {
+			t.Errorf("unexpected test file: %v", filename)
+		}
+	}
+
+	xpkg, err := imp.ImportTestPackage("./foo")
+	if err != nil {
+		t.Fatalf("failed to import test package: %v", err)
+	}
+	if xpkg.Name != "foo_test" {
+		t.Errorf("unexpected test package name: %v", xpkg.Name)
+	}
+	if impast.FindTypeByName(xpkg, "External") == nil || impast.FindTypeByName(xpkg, "Fake") != nil {
+		t.Error("external test package must only contain its own files")
+	}
+}
+
+func TestImporter_GetMethodSet(t *testing.T) {
+	pkgs := map[string]*ast.Package{
+		"example.com/foo": {
+			Name: "foo",
+			Files: map[string]*ast.File{
+				"foo.go": mustParseFile(`
+package foo
+
+type Base struct{}
+
+func (Base) V() {}
+
+func (*Base) P() {}
+
+type PtrBase struct{}
+
+func (PtrBase) PV() {}
+
+func (*PtrBase) PP() {}
+
+type Foo struct {
+	Base
+	*PtrBase
+}
+
+func (Foo) FV() {}
+
+func (*Foo) FP() {}
+`),
+			},
+		},
+	}
+	imp := &impast.Importer{}
+	imp.Load(pkgs)
+	pkg := pkgs["example.com/foo"]
+
+	tests := []struct {
+		pointer  bool
+		expected []string
+	}{
+		{pointer: false, expected: []string{"FV", "PP", "PV", "V"}},
+		{pointer: true, expected: []string{"FP", "FV", "P", "PP", "PV", "V"}},
+	}
+	for _, test := range tests {
+		methods, err := imp.GetMethodSet(pkg, "Foo", test.pointer)
+		if err != nil {
+			t.Errorf("failed to get method set(%v): %v", test.pointer, err)
+			continue
+		}
+		var got []string
+		for _, m := range methods {
+			got = append(got, m.Name.Name)
+		}
+		if !reflect.DeepEqual(got, test.expected) {
+			t.Errorf("unexpected method set(%v). expected: %v, but got: %v", test.pointer, test.expected, got)
+		}
+	}
+}
+
+func TestImporter_LookupMethodSet(t *testing.T) {
+	pkgs := map[string]*ast.Package{
+		"example.com/foo": {
+			Name: "foo",
+			Files: map[string]*ast.File{
+				"foo.go": mustParseFile(`
+package foo
+
+type A struct{}
+
+func (A) Close() error { return nil }
+
+func (A) Name() string { return "" }
+
+type B struct {
+	C
+}
+
+func (B) Close() error { return nil }
+
+type C struct{}
+
+func (C) Name() int { return 0 }
+
+func (C) Extra() {}
+
+type E struct{}
+
+func (E) Size() int { return 0 }
+
+type Foo struct {
+	A
+	B
+	E
+	Size int
+}
+`),
+			},
+		},
+	}
+	imp := &impast.Importer{}
+	imp.Load(pkgs)
+
+	ms, err := imp.LookupMethodSet(pkgs["example.com/foo"], "Foo", true)
+	if err != nil {
+		t.Fatalf("failed to lookup method set: %v", err)
+	}
+	var got []string
+	for _, m := range ms.Methods {
+		got = append(got, signature(m))
+	}
+	if expected := []string{"Extra()()", "Name()(string)"}; !reflect.DeepEqual(got, expected) {
+		t.Errorf("unexpected methods. expected: %v, but got: %v", expected, got)
+	}
+	if expected := []string{"Close"}; !reflect.DeepEqual(ms.Ambiguous, expected) {
+		t.Errorf("unexpected ambiguous methods. expected: %v, but got: %v", expected, ms.Ambiguous)
+	}
+}
+
+func TestImporter_GetMethodsDeepCycle(t *testing.T) {
+	pkgs := map[string]*ast.Package{
+		"example.com/a": {
+			Name: "a",
+			Files: map[string]*ast.File{
+				"a.go": mustParseFile(`
+package a
+
+import "example.com/b"
+
+type A struct {
+	*b.B
+}
+
+func (A) Foo() {}
+
+type Node struct {
+	*Node
+	Value int
+}
+
+func (n *Node) Next() *Node { return n.Node }
+
+type T struct {
+	U
+}
+
+type U struct {
+	T
+}
+`),
+			},
+		},
+		"example.com/b": {
+			Name: "b",
+			Files: map[string]*ast.File{
+				"b.go": mustParseFile(`
+package b
+
+import "example.com/a"
+
+type B struct {
+	*a.A
+}
+
+func (*B) Bar() {}
+`),
+			},
+		},
+	}
+	imp := &impast.Importer{EnableCache: true}
+	imp.Load(pkgs)
+
+	tests := []struct {
+		pkg  string
+		name string
+
+		expected []string
+	}{
+		{pkg: "example.com/a", name: "Node", expected: []string{"Next()(*a.Node)"}},
+		{pkg: "example.com/a", name: "A", expected: []string{"Bar()()", "Foo()()"}},
+		{pkg: "example.com/b", name: "B", expected: []string{"Bar()()", "Foo()()"}},
+	}
+	for _, test := range tests {
+		methods, err := imp.GetMethodsDeep(pkgs[test.pkg], test.name)
+		if err != nil {
+			t.Errorf("failed to get methods %v: %v", test.name, err)
+			continue
+		}
+		var got []string
+		for _, m := range methods {
+			got = append(got, signature(m))
+		}
+		if !reflect.DeepEqual(got, test.expected) {
+			t.Errorf("unexpected signatures of %v. expected: %v, but got: %v", test.name, test.expected, got)
+		}
+	}
+
+	if _, err := imp.GetMethodsDeep(pkgs["example.com/a"], "T"); err == nil {
+		t.Error("expected error for invalid recursive type")
+	}
+}
+
+func TestImporter_GetMethodsDeepInterface(t *testing.T) {
+	pkgs := map[string]*ast.Package{
+		"example.com/foo": {
+			Name: "foo",
+			Files: map[string]*ast.File{
+				"foo.go": mustParseFile(`
+package foo
+
+import "example.com/stream"
+
+type Kind int
+
+type Named interface {
+	Name() Kind
+}
+
+type Counting struct {
+	stream.ReadCloser
+	Named
+	n int
+}
+
+func (c *Counting) Read(p []byte) (int, error) {
+	return 0, nil
+}
+`),
+			},
+		},
+		"example.com/stream": {
+			Name: "stream",
+			Files: map[string]*ast.File{
+				"stream.go": mustParseFile(`
+package stream
+
+type Reader interface {
+	Read(p []byte) (n int, err error)
+}
+
+type ReadCloser interface {
+	Reader
+	Close() error
+}
+`),
+			},
+		},
+	}
+	imp := &impast.Importer{EnableCache: true}
+	imp.Load(pkgs)
+
+	tests := []struct {
+		pointer  bool
+		expected []string
+	}{
+		{pointer: true, expected: []string{"Close()(error)", "Name()(foo.Kind)", "Read([]byte)(int,error)"}},
+		{pointer: false, expected: []string{"Close()(error)", "Name()(foo.Kind)"}},
+	}
+	for _, test := range tests {
+		methods, err := imp.GetMethodSet(pkgs["example.com/foo"], "Counting", test.pointer)
+		if err != nil {
+			t.Fatalf("failed to get methods: %v", err)
+		}
+		var got []string
+		for _, m := range methods {
+			got = append(got, signature(m))
+		}
+		if !reflect.DeepEqual(got, test.expected) {
+			t.Errorf("unexpected signatures(pointer=%v). expected: %v, but got: %v", test.pointer, test.expected, got)
+		}
+	}
+}
+
+func TestImporter_GetMethodsDeepNamed(t *testing.T) {
+	pkgs := map[string]*ast.Package{
+		"example.com/foo": {
+			Name: "foo",
+			Files: map[string]*ast.File{
+				"foo.go": mustParseFile(`
+package foo
+
+import "net/http"
+
+type HandlerFunc func(w http.ResponseWriter, r *http.Request)
+
+func (f HandlerFunc) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f(w, r)
+}
+
+type IDs []string
+
+func (ids IDs) Len() int { return len(ids) }
+
+func (ids *IDs) Add(id string) { *ids = append(*ids, id) }
+
+type Level int
+
+func (l Level) String() string { return "" }
+
+type Logger struct {
+	Level
+}
+`),
+			},
+		},
+	}
+	imp := &impast.Importer{EnableCache: true}
+	imp.Load(pkgs)
+
+	tests := []struct {
+		name    string
+		pointer bool
+
+		expected []string
+	}{
+		{name: "HandlerFunc", pointer: true, expected: []string{"ServeHTTP(http.ResponseWriter,*http.Request)()"}},
+		{name: "IDs", pointer: true, expected: []string{"Add(string)()", "Len()(int)"}},
+		{name: "IDs", pointer: false, expected: []string{"Len()(int)"}},
+		{name: "Logger", pointer: false, expected: []string{"String()(string)"}},
+	}
+	for _, test := range tests {
+		methods, err := imp.GetMethodSet(pkgs["example.com/foo"], test.name, test.pointer)
+		if err != nil {
+			t.Errorf("failed to get methods %v: %v", test.name, err)
+			continue
+		}
+		var got []string
+		for _, m := range methods {
+			got = append(got, signature(m))
+		}
+		if !reflect.DeepEqual(got, test.expected) {
+			t.Errorf("unexpected signatures of %v(pointer=%v). expected: %v, but got: %v", test.name, test.pointer, test.expected, got)
+		}
+	}
+}
+
+func TestImporter_ConcurrentNested(t *testing.T) {
+	const depth, fanout = 3, 3
+	var b strings.Builder
+	b.WriteString("package nested\n")
+	width := 1
+	for d := 0; d < depth; d++ {
+		for j := 0; j < width; j++ {
+			fmt.Fprintf(&b, "type T%d_%d struct {\n", d, j)
+			for k := 0; k < fanout; k++ {
+				fmt.Fprintf(&b, "\tT%d_%d\n", d+1, j*fanout+k)
+			}
+			b.WriteString("}\n")
+		}
+		width *= fanout
+	}
+	var expected []string
+	for j := 0; j < width; j++ {
+		fmt.Fprintf(&b, "type T%d_%d struct{}\nfunc (T%d_%d) M%03d() {}\n", depth, j, depth, j, j)
+		expected = append(expected, fmt.Sprintf("M%03d", j))
+	}
+	pkg := &ast.Package{Name: "nested", Files: map[string]*ast.File{"nested.go": mustParseFile(b.String())}}
+
+	for _, concurrency := range []int{0, 1, 2, 8} {
+		imp := &impast.Importer{Concurrency: concurrency}
+		methods, err := imp.GetMethodsDeep(pkg, "T0_0")
+		if err != nil {
+			t.Fatalf("failed to get methods(concurrency=%v): %v", concurrency, err)
+		}
+		var got []string
+		for _, m := range methods {
+			got = append(got, m.Name.Name)
+		}
+		if !reflect.DeepEqual(got, expected) {
+			t.Errorf("unexpected methods(concurrency=%v). expected: %v, but got: %v", concurrency, expected, got)
+		}
+	}
+}
@@ -0,0 +1,253 @@
+package impast
+
+import (
+	"fmt"
+	"go/ast"
+	"go/token"
+	"sort"
+	"strconv"
+)
+
+// Imports is the set of packages referred to by a generated file.
+// The zero value is an empty set.
+type Imports struct {
+	names    map[string]string // import path -> qualifier
+	paths    map[string]string // qualifier -> import path
+	pkgNames map[string]string // import path -> package name
+	local    map[string]bool   // import paths of the generated file's own package
+}
+
+// Add records importPath, whose package is named name, and returns the qualifier to use
+// for it in the generated file. A numbered alias is assigned if name is taken by another package.
+func (im *Imports) Add(importPath, name string) string {
+	if q, ok := im.names[importPath]; ok {
+		return q
+	}
+	if im.names == nil {
+		im.names = map[string]string{}
+		im.paths = map[string]string{}
+		im.pkgNames = map[string]string{}
+	}
+	q := name
+	for n := 2; im.paths[q] != ""; n++ {
+		q = name + strconv.Itoa(n)
+	}
+	im.names[importPath] = q
+	im.paths[q] = importPath
+	im.pkgNames[importPath] = name
+	return q
+}
+
+func (im *Imports) Lookup(importPath string) (string, bool) {
+	q, ok := im.names[importPath]
+	return q, ok
+}
+
+func (im *Imports) Len() int {
+	return len(im.names)
+}
+
+// Localize is the inverse of ExportTypeTo for code generated into the package of
+// importPath: it removes the qualifier of importPath from expr and leaves the
+// package out of the import declaration.
+func (im *Imports) Localize(importPath string, expr ast.Expr) ast.Expr {
+	q, ok := im.markLocal(importPath)
+	if !ok {
+		return expr
+	}
+	return mapNames(expr, identity, unqualify(q))
+}
+
+func (im *Imports) LocalizeFields(importPath string, fields *ast.FieldList) *ast.FieldList {
+	q, ok := im.markLocal(importPath)
+	if !ok {
+		return fields
+	}
+	return mapFieldNames(fields, identity, unqualify(q))
+}
+
+func (im *Imports) markLocal(importPath string) (string, bool) {
+	q, ok := im.names[importPath]
+	if !ok {
+		return "", false
+	}
+	if im.local == nil {
+		im.local = map[string]bool{}
+	}
+	im.local[importPath] = true
+	return q, true
+}
+
+// Specs returns the import specs sorted by path. Name is set only when the qualifier
+// differs from the package name or the package name differs from the import path.
+func (im *Imports) Specs() []*ast.ImportSpec {
+	paths := make([]string, 0, len(im.names))
+	for p := range im.names {
+		if !im.local[p] {
+			paths = append(paths, p)
+		}
+	}
+	sort.Strings(paths)
+
+	specs := make([]*ast.ImportSpec, 0, len(paths))
+	for _, p := range paths {
+		spec := &ast.ImportSpec{Path: &ast.BasicLit{Kind: token.STRING, Value: strconv.Quote(p)}}
+		if q := im.names[p]; q != im.pkgNames[p] || q != assumedPackageName(p) {
+			spec.Name = ast.NewIdent(q)
+		}
+		specs = append(specs, spec)
+	}
+	return specs
+}
+
+// Decl returns the import declaration of the set, or nil if it is empty.
+func (im *Imports) Decl() *ast.GenDecl {
+	specs := im.Specs()
+	if len(specs) == 0 {
+		return nil
+	}
+	decl := &ast.GenDecl{Tok: token.IMPORT, Lparen: 1, Rparen: 1}
+	for _, spec := range specs {
+		decl.Specs = append(decl.Specs, spec)
+	}
+	return decl
+}
+
+func ExportTypeTo(im *Imports, pkg *ast.Package, f *ast.File, expr ast.Expr) (ast.Expr, error) {
+	return DefaultImporter.ExportTypeTo(im, pkg, f, expr)
+}
+
+// ExportTypeTo is like ExportType, but qualifies identifiers of pkg with the name
+// recorded for its import path in im. Qualified identifiers are resolved through
+// the imports of f, the file expr is written in, and requalified the same way.
+// pkg must be loaded by the importer, which knows its import path.
+func (i *Importer) ExportTypeTo(im *Imports, pkg *ast.Package, f *ast.File, expr ast.Expr) (ast.Expr, error) {
+	return i.exportTypeTo(im, pkg, f, expr, nil)
+}
+
+func ExportGenericTypeTo(im *Imports, pkg *ast.Package, f *ast.File, tparams *ast.FieldList, expr ast.Expr) (ast.Expr, error) {
+	return DefaultImporter.ExportGenericTypeTo(im, pkg, f, tparams, expr)
+}
+
+func (i *Importer) ExportGenericTypeTo(im *Imports, pkg *ast.Package, f *ast.File, tparams *ast.FieldList, expr ast.Expr) (ast.Expr, error) {
+	return i.exportTypeTo(im, pkg, f, expr, typeParamNames(tparams))
+}
+
+func ExportTypeParamsTo(im *Imports, pkg *ast.Package, f *ast.File, tparams *ast.FieldList) (*ast.FieldList, error) {
+	return DefaultImporter.ExportTypeParamsTo(im, pkg, f, tparams)
+}
+
+func (i *Importer) ExportTypeParamsTo(im *Imports, pkg *ast.Package, f *ast.File, tparams *ast.FieldList) (*ast.FieldList, error) {
+	if _, ok := i.ImportPath(pkg); !ok {
+		return nil, errNotLoaded(pkg)
+	}
+	names := typeParamNames(tparams)
+	return mapFieldNames(tparams, func(id *ast.Ident) ast.Expr {
+		return im.Qualify(i.exportTypeIn(pkg, f, id, names))
+	}, func(se *ast.SelectorExpr) ast.Expr {
+		return im.Qualify(i.resolveSelector(f, se))
+	}), nil
+}
+
+func (i *Importer) exportTypeTo(im *Imports, pkg *ast.Package, f *ast.File, expr ast.Expr, scope []string) (ast.Expr, error) {
+	if _, ok := i.ImportPath(pkg); !ok {
+		return nil, errNotLoaded(pkg)
+	}
+	return im.Qualify(i.exportTypeIn(pkg, f, expr, scope)), nil
+}
+
+// Qualify rewrites the qualifiers that carry their import path, as the ones written by
+// the importer do, to the names recorded for them in im.
+func (im *Imports) Qualify(expr ast.Expr) ast.Expr {
+	return mapNames(expr, identity, func(se *ast.SelectorExpr) ast.Expr {
+		importPath, name, ok := qualifierPath(se)
+		if !ok {
+			return se
+		}
+		return &ast.SelectorExpr{X: ast.NewIdent(im.Add(importPath, name)), Sel: se.Sel}
+	})
+}
+
+func errNotLoaded(pkg *ast.Package) error {
+	return fmt.Errorf("package %v is not loaded by importer: %w", pkg.Name, &PackageNotFoundError{Path: pkg.Name})
+}
+
+// ImportPath returns the import path pkg was loaded from by the importer.
+func (i *Importer) ImportPath(pkg *ast.Package) (string, bool) {
+	info, ok := i.loadedPackage(pkg)
+	if !ok {
+		return "", false
+	}
+	return info.path, true
+}
+
+// exportTypeIn is like exportType, but the qualifiers it writes, and those of f it finds,
+// carry their import path so that the result can be qualified for another file.
+func (i *Importer) exportTypeIn(pkg *ast.Package, f *ast.File, expr ast.Expr, scope []string) ast.Expr {
+	importPath, loaded := i.ImportPath(pkg)
+	return mapNames(expr, func(id *ast.Ident) ast.Expr {
+		e := qualify(pkg, id, scope)
+		if se, ok := e.(*ast.SelectorExpr); ok && loaded {
+			se.X = pkgIdent(pkg.Name, pkg.Name, importPath)
+		}
+		return e
+	}, func(se *ast.SelectorExpr) ast.Expr {
+		return i.resolveSelector(f, se)
+	})
+}
+
+func (i *Importer) resolveSelector(f *ast.File, se *ast.SelectorExpr) ast.Expr {
+	x, ok := se.X.(*ast.Ident)
+	if !ok || f == nil || x.Obj != nil {
+		return se
+	}
+	importPath, name, ok := i.importOf(f, x.Name)
+	if !ok {
+		return se
+	}
+	return &ast.SelectorExpr{X: pkgIdent(x.Name, name, importPath), Sel: se.Sel}
+}
+
+// pkgIdent returns the qualifier ident of a package named name, which remembers its import path.
+func pkgIdent(qualifier, name, importPath string) *ast.Ident {
+	return &ast.Ident{Name: qualifier, Obj: &ast.Object{Kind: ast.Pkg, Name: name, Data: importPath}}
+}
+
+func qualifierPath(se *ast.SelectorExpr) (string, string, bool) {
+	x, ok := se.X.(*ast.Ident)
+	if !ok || x.Obj == nil || x.Obj.Kind != ast.Pkg {
+		return "", "", false
+	}
+	importPath, ok := x.Obj.Data.(string)
+	return importPath, x.Obj.Name, ok
+}
+
+// importOf returns the import path and the package name that name refers to in f.
+// The name is matched against the one assumed from the import path first, so that
+// the imports of f are only loaded when it differs.
+func (i *Importer) importOf(f *ast.File, name string) (string, string, bool) {
+	var unnamed []string
+	for _, spec := range f.Imports {
+		p, err := strconv.Unquote(spec.Path.Value)
+		if err != nil {
+			continue
+		}
+		switch {
+		case spec.Name == nil && assumedPackageName(p) == name:
+			return p, name, true
+		case spec.Name == nil:
+			unnamed = append(unnamed, p)
+		case spec.Name.Name == name:
+			if pkg, err := i.ImportFrom(p, i.srcDir(f)); err == nil {
+				return p, pkg.Name, true
+			}
+			return p, assumedPackageName(p), true
+		}
+	}
+	for _, p := range unnamed {
+		if pkg, err := i.ImportFrom(p, i.srcDir(f)); err == nil && pkg.Name == name {
+			return p, name, true
+		}
+	}
+	return "", "", false
+}
@@ -0,0 +1,190 @@
+package impast_test
+
+import (
+	"bytes"
+	"errors"
+	"go/ast"
+	"go/printer"
+	"go/token"
+	"testing"
+
+	"github.com/orisano/impast"
+)
+
+func TestImporter_ExportTypeTo(t *testing.T) {
+	pkgs := map[string]*ast.Package{
+		"crypto/rand": {
+			Name: "rand",
+			Files: map[string]*ast.File{
+				"rand.go": mustParseFile(`
+package rand
+
+type Reader interface{}
+`),
+			},
+		},
+		"math/rand": {
+			Name: "rand",
+			Files: map[string]*ast.File{
+				"rand.go": mustParseFile(`
+package rand
+
+type Source interface{}
+`),
+			},
+		},
+		"example.com/go-yaml/v3": {
+			Name: "yaml",
+			Files: map[string]*ast.File{
+				"yaml.go": mustParseFile(`
+package yaml
+
+type Node struct{}
+`),
+			},
+		},
+	}
+	imp := &impast.Importer{EnableCache: true}
+	imp.Load(pkgs)
+
+	var im impast.Imports
+	tests := []struct {
+		pkg  string
+		expr string
+
+		expected string
+	}{
+		{pkg: "crypto/rand", expr: "func(Reader) []Reader", expected: "func(rand.Reader) []rand.Reader"},
+		{pkg: "math/rand", expr: "map[Source]int", expected: "map[rand2.Source]int"},
+		{pkg: "example.com/go-yaml/v3", expr: "*Node", expected: "*yaml.Node"},
+		{pkg: "crypto/rand", expr: "chan Reader", expected: "chan rand.Reader"},
+	}
+	for _, test := range tests {
+		got, err := imp.ExportTypeTo(&im, pkgs[test.pkg], nil, mustParseExpr(test.expr))
+		if err != nil {
+			t.Errorf("failed to export %v: %v", test.expr, err)
+			continue
+		}
+		if s := nodeString(got); s != test.expected {
+			t.Errorf("unexpected type. expected: %v, but got: %v", test.expected, s)
+		}
+	}
+
+	expected := `import (
+	"crypto/rand"
+	"example.com/go-yaml/v3"
+	rand2 "math/rand"
+)`
+	if got := nodeString(im.Decl()); got != expected {
+		t.Errorf("unexpected import decl. expected: %v, but got: %v", expected, got)
+	}
+	if q, ok := im.Lookup("math/rand"); !ok || q != "rand2" {
+		t.Errorf("unexpected qualifier: %v", q)
+	}
+	if d := (&impast.Imports{}).Decl(); d != nil {
+		t.Errorf("expected nil decl, but got: %v", nodeString(d))
+	}
+
+	if _, err := (&impast.Importer{}).ExportTypeTo(&im, pkgs["math/rand"], nil, mustParseExpr("Source")); !errors.Is(err, impast.PackageNotFound) {
+		t.Errorf("expected PackageNotFound for a package of another importer, but got: %v", err)
+	}
+	if im.Len() != 3 {
+		t.Errorf("unexpected imports: %v", nodeString(im.Decl()))
+	}
+}
+
+func TestImporter_ExportTypeToRequalify(t *testing.T) {
+	pkgs := map[string]*ast.Package{
+		"example.com/a": {
+			Name: "a",
+			Files: map[string]*ast.File{
+				"a.go": mustParseFile(`
+package a
+
+import (
+	bb "example.com/b"
+	"example.com/x/rand"
+)
+
+type Local struct{}
+`),
+			},
+		},
+		"example.com/b": {
+			Name: "thing",
+			Files: map[string]*ast.File{
+				"b.go": mustParseFile(`
+package thing
+
+type Thing struct{}
+`),
+			},
+		},
+		"example.com/x/rand": {
+			Name: "rand",
+			Files: map[string]*ast.File{
+				"rand.go": mustParseFile(`
+package rand
+
+type Source interface{}
+`),
+			},
+		},
+	}
+	imp := &impast.Importer{EnableCache: true}
+	imp.Load(pkgs)
+
+	var im impast.Imports
+	im.Add("math/rand", "rand")
+
+	pkg := pkgs["example.com/a"]
+	expr := mustParseExpr("func(bb.Thing, *Local) (rand.Source, error)")
+	got, err := imp.ExportTypeTo(&im, pkg, pkg.Files["a.go"], expr)
+	if err != nil {
+		t.Fatalf("failed to export: %v", err)
+	}
+	if expected := "func(thing.Thing, *a.Local) (rand2.Source, error)"; nodeString(got) != expected {
+		t.Errorf("unexpected type. expected: %v, but got: %v", expected, nodeString(got))
+	}
+
+	expected := `import (
+	"example.com/a"
+	thing "example.com/b"
+	rand2 "example.com/x/rand"
+	"math/rand"
+)`
+	if got := nodeString(im.Decl()); got != expected {
+		t.Errorf("unexpected import decl. expected: %v, but got: %v", expected, got)
+	}
+}
+
+func TestImports_Localize(t *testing.T) {
+	var im impast.Imports
+	q := im.Add("example.com/foo", "foo")
+	im.Add("example.com/bar", "bar")
+
+	expr := &ast.StarExpr{X: &ast.SelectorExpr{X: ast.NewIdent(q), Sel: ast.NewIdent("Foo")}}
+	if got := nodeString(im.Localize("example.com/foo", expr)); got != "*Foo" {
+		t.Errorf("unexpected type: %v", got)
+	}
+	if got := nodeString(im.Localize("example.com/baz", expr)); got != "*foo.Foo" {
+		t.Errorf("unexpected type: %v", got)
+	}
+	fields := &ast.FieldList{List: []*ast.Field{{Names: []*ast.Ident{ast.NewIdent("T")}, Type: expr}}}
+	if got := impast.TypeName(im.LocalizeFields("example.com/foo", fields).List[0].Type); got != "*Foo" {
+		t.Errorf("unexpected type parameter constraint: %v", got)
+	}
+
+	expected := `import (
+	"example.com/bar"
+)`
+	if got := nodeString(im.Decl()); got != expected {
+		t.Errorf("unexpected import decl. expected: %v, but got: %v", expected, got)
+	}
+}
+
+func nodeString(node ast.Node) string {
+	var b bytes.Buffer
+	printer.Fprint(&b, token.NewFileSet(), node)
+	return b.String()
+}
@@ -0,0 +1,142 @@
+package impast
+
+import (
+	"go/ast"
+	"go/token"
+	"weak"
+)
+
+type Index struct {
+	decls   []ast.Decl
+	files   map[ast.Decl]*ast.File
+	types   map[string]typeDecl
+	methods map[string][]*ast.FuncDecl
+	funcs   map[string]*ast.FuncDecl
+	consts  map[string]*ast.ValueSpec
+	vars    map[string]*ast.ValueSpec
+}
+
+type typeDecl struct {
+	spec *ast.TypeSpec
+	file *ast.File
+}
+
+func IndexPackage(pkg *ast.Package) *Index {
+	return DefaultImporter.IndexPackage(pkg)
+}
+
+// IndexPackage returns the index built when pkg was loaded by the importer.
+// Packages the importer did not load are indexed on every call, so changes to them are always seen.
+func (i *Importer) IndexPackage(pkg *ast.Package) *Index {
+	if idx, ok := i.index(pkg); ok {
+		return idx
+	}
+	return newIndex(pkg)
+}
+
+func (i *Importer) index(pkg *ast.Package) (*Index, bool) {
+	v, ok := i.indexes.Load(weak.Make(pkg))
+	if !ok {
+		return nil, false
+	}
+	return v.(*Index), true
+}
+
+// scanDecls calls f with the declarations of pkg in the order they are indexed, until f returns false.
+// It is used for packages that are not indexed, where building an index to look up a few
+// names would cost more than a scan.
+func scanDecls(pkg *ast.Package, f func(*ast.File, ast.Decl) bool) {
+	for _, filename := range sortedNames(pkg.Files) {
+		file := pkg.Files[filename]
+		for _, decl := range file.Decls {
+			if !f(file, decl) {
+				return
+			}
+		}
+	}
+}
+
+func newIndex(pkg *ast.Package) *Index {
+	x := &Index{
+		files:   map[ast.Decl]*ast.File{},
+		types:   map[string]typeDecl{},
+		methods: map[string][]*ast.FuncDecl{},
+		funcs:   map[string]*ast.FuncDecl{},
+		consts:  map[string]*ast.ValueSpec{},
+		vars:    map[string]*ast.ValueSpec{},
+	}
+	for _, filename := range sortedNames(pkg.Files) {
+		f := pkg.Files[filename]
+		for _, decl := range f.Decls {
+			x.decls = append(x.decls, decl)
+			x.files[decl] = f
+			switch d := decl.(type) {
+			case *ast.FuncDecl:
+				if d.Recv == nil || len(d.Recv.List) == 0 {
+					if _, ok := x.funcs[d.Name.Name]; !ok {
+						x.funcs[d.Name.Name] = d
+					}
+					continue
+				}
+				if id, ok := baseType(d.Recv.List[0].Type).(*ast.Ident); ok {
+					x.methods[id.Name] = append(x.methods[id.Name], d)
+				}
+			case *ast.GenDecl:
+				x.addGenDecl(f, d)
+			}
+		}
+	}
+	return x
+}
+
+func (x *Index) addGenDecl(f *ast.File, d *ast.GenDecl) {
+	for _, spec := range d.Specs {
+		switch s := spec.(type) {
+		case *ast.TypeSpec:
+			if _, ok := x.types[s.Name.Name]; !ok {
+				x.types[s.Name.Name] = typeDecl{spec: s, file: f}
+			}
+		case *ast.ValueSpec:
+			values := x.vars
+			if d.Tok == token.CONST {
+				values = x.consts
+			}
+			for _, name := range s.Names {
+				if _, ok := values[name.Name]; !ok && name.Name != "_" {
+					values[name.Name] = s
+				}
+			}
+		}
+	}
+}
+
+func (x *Index) Decls() []ast.Decl {
+	return x.decls
+}
+
+// File returns the file that declares decl.
+func (x *Index) File(decl ast.Decl) *ast.File {
+	return x.files[decl]
+}
+
+func (x *Index) Type(name string) (*ast.TypeSpec, *ast.File) {
+	t := x.types[name]
+	return t.spec, t.file
+}
+
+// Methods returns the methods declared with name as the receiver base type, in source order.
+func (x *Index) Methods(name string) []*ast.FuncDecl {
+	return x.methods[name]
+}
+
+func (x *Index) Func(name string) *ast.FuncDecl {
+	return x.funcs[name]
+}
+
+func (x *Index) Const(name string) *ast.ValueSpec {
+	return x.consts[name]
+}
+
+func (x *Index) Var(name string) *ast.ValueSpec {
+	return x.vars[name]
+}
@@ -0,0 +1,114 @@
+package impast_test
+
+import (
+	"go/ast"
+	"reflect"
+	"testing"
+
+	"github.com/orisano/impast"
+)
+
+func TestIndexPackage(t *testing.T) {
+	pkg := &ast.Package{
+		Name: "foo",
+		Files: map[string]*ast.File{
+			"a.go": mustParseFile(`
+package foo
+
+const (
+	A, B = 1, 2
+)
+
+var v, _ = 1, 2
+
+type Foo struct{}
+
+func (f Foo) Get() int { return 0 }
+
+func New() *Foo { return nil }
+`),
+			"b.go": mustParseFile(`
+package foo
+
+type Cache[K comparable, V any] struct{}
+
+func (f *Foo) Set(n int) {}
+
+func (c *Cache[K, V]) Get(k K) V { var v V; return v }
+
+func (f *Foo) reset() {}
+`),
+		},
+	}
+
+	imp := &impast.Importer{}
+	imp.Load(map[string]*ast.Package{"example.com/foo": pkg})
+	idx := imp.IndexPackage(pkg)
+	if idx != imp.IndexPackage(pkg) {
+		t.Error("index must be reused")
+	}
+	if ts, f := idx.Type("Foo"); ts == nil || f != pkg.Files["a.go"] {
+		t.Error("type Foo must be indexed with its file")
+	}
+	if ts, _ := idx.Type("Bar"); ts != nil {
+		t.Error("unexpected type Bar")
+	}
+	var got []string
+	for _, m := range idx.Methods("Foo") {
+		got = append(got, m.Name.Name)
+	}
+	if expected := []string{"Get", "Set", "reset"}; !reflect.DeepEqual(got, expected) {
+		t.Errorf("unexpected methods. expected: %v, but got: %v", expected, got)
+	}
+	if len(idx.Methods("Cache")) != 1 {
+		t.Error("generic receiver must be indexed by its base type")
+	}
+	if idx.Func("New") == nil || idx.Func("Get") != nil {
+		t.Error("only plain functions must be indexed as funcs")
+	}
+	if idx.File(idx.Methods("Foo")[1]) != pkg.Files["b.go"] {
+		t.Error("method Set must be indexed with its file")
+	}
+	if idx.Const("A") == nil || idx.Const("B") == nil || idx.Var("v") == nil || idx.Var("_") != nil || idx.Const("v") != nil {
+		t.Error("unexpected values")
+	}
+	if n := len(idx.Decls()); n != 9 {
+		t.Errorf("unexpected number of decls: %v", n)
+	}
+}
+
+func TestImporter_InvalidateIndex(t *testing.T) {
+	pkgs := map[string]*ast.Package{
+		"example.com/foo": {
+			Name:  "foo",
+			Files: map[string]*ast.File{"foo.go": mustParseFile("package foo\n\ntype Foo struct{}\n")},
+		},
+	}
+	imp := &impast.Importer{EnableCache: true}
+	imp.Load(pkgs)
+	pkg := pkgs["example.com/foo"]
+	idx := imp.IndexPackage(pkg)
+
+	pkg.Files["bar.go"] = mustParseFile("package foo\n\ntype Bar struct{}\n")
+	imp.Invalidate("example.com/foo")
+	if imp.IndexPackage(pkg) == idx {
+		t.Error("index must be rebuilt after invalidation")
+	}
+	if imp.FindStruct(pkg, "Bar") == nil {
+		t.Error("Bar must be found after invalidation")
+	}
+}
+
+func TestIndexPackage_NotLoaded(t *testing.T) {
+	pkg := &ast.Package{
+		Name:  "foo",
+		Files: map[string]*ast.File{"bar.go": mustParseFile("package foo\n\ntype Bar struct{}\n")},
+	}
+	if impast.FindTypeByName(pkg, "Foo") != nil {
+		t.Fatal("unexpected type Foo")
+	}
+	pkg.Files["foo.go"] = mustParseFile("package foo\n\ntype Foo struct{}\n")
+	if impast.FindTypeByName(pkg, "Foo") == nil {
+		t.Error("Foo must be found after it is added")
+	}
+}
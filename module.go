@@ -0,0 +1,416 @@
+package impast
+
+import (
+	"fmt"
+	"go/build"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"golang.org/x/mod/modfile"
+	"golang.org/x/mod/module"
+	"golang.org/x/mod/semver"
+)
+
+type modInfo struct {
+	root     string
+	file     *modfile.File
+	modCache string
+}
+
+type workInfo struct {
+	root     string
+	file     *modfile.WorkFile
+	mods     []*modInfo
+	modCache string
+}
+
+func (i *Importer) findPackage(importPath, srcDir string) (string, string, error) {
+	if build.IsLocalImport(importPath) {
+		if dir, pkgPath, ok := i.localModulePackage(filepath.Join(srcDir, importPath)); ok {
+			return dir, pkgPath, nil
+		}
+	}
+	dir, found, err := i.findModulePackage(importPath, srcDir)
+	if err != nil {
+		return "", "", err
+	}
+	if found {
+		return dir, importPath, nil
+	}
+	pkg, err := i.context().Import(importPath, srcDir, build.FindOnly)
+	if err != nil {
+		return "", "", fmt.Errorf("%w: %w", &PackageNotFoundError{Path: importPath, Dir: srcDir}, err)
+	}
+	return pkg.Dir, pkg.ImportPath, nil
+}
+
+// moduleRoot returns the root of the workspace or the module srcDir belongs to,
+// or an empty string in GOPATH mode.
+func (i *Importer) moduleRoot(srcDir string) string {
+	dir := i.abs(srcDir)
+	if v, ok := i.roots.Load(dir); ok {
+		return v.(string)
+	}
+	var root string
+	if os.Getenv("GO111MODULE") != "off" {
+		if work, err := i.findWorkspace(dir); err == nil && work != nil {
+			root = work.root
+		} else if mod, err := i.findModule(dir); err == nil && mod != nil {
+			root = mod.root
+		}
+	}
+	i.roots.Store(dir, root)
+	return root
+}
+
+func (i *Importer) localModulePackage(dir string) (string, string, bool) {
+	dir = i.abs(dir)
+	if !i.isDir(dir) || os.Getenv("GO111MODULE") == "off" {
+		return "", "", false
+	}
+	mod, err := i.findModule(dir)
+	if err != nil || mod == nil {
+		return "", "", false
+	}
+	rel, _ := hasSubdir(mod.root, dir)
+	return dir, path.Join(mod.file.Module.Mod.Path, filepath.ToSlash(rel)), true
+}
+
+func (i *Importer) findModulePackage(importPath, srcDir string) (string, bool, error) {
+	if build.IsLocalImport(importPath) || os.Getenv("GO111MODULE") == "off" {
+		return "", false, nil
+	}
+	absDir := i.abs(srcDir)
+	if _, ok := hasSubdir(filepath.Join(i.buildContext().GOROOT, "src"), absDir); ok {
+		return "", false, nil
+	}
+	work, err := i.findWorkspace(absDir)
+	if err != nil {
+		return "", false, err
+	}
+	if work != nil {
+		work.modCache = modCacheRoot(i.buildContext())
+		return i.findWorkspacePackage(work, importPath)
+	}
+	mod, err := i.findModule(absDir)
+	if err != nil {
+		return "", false, err
+	}
+	if mod == nil {
+		return "", false, nil
+	}
+	mod.modCache = modCacheRoot(i.buildContext())
+
+	modPath := mod.file.Module.Mod.Path
+	if sub, ok := hasPathPrefix(importPath, modPath); ok {
+		dir := filepath.Join(mod.root, filepath.FromSlash(sub))
+		return dir, i.isDir(dir), nil
+	}
+	// the main module may have a path without a dot, which looks like the standard library.
+	if isStandardImportPath(importPath) {
+		return "", false, nil
+	}
+
+	if vendorEnabled(i.isDir(filepath.Join(mod.root, "vendor")), mod.file.Go, "v1.14") {
+		dir := filepath.Join(mod.root, "vendor", filepath.FromSlash(importPath))
+		if !i.isDir(dir) {
+			return "", false, &PackageNotFoundError{Path: importPath, Dir: filepath.Join(mod.root, "vendor")}
+		}
+		return dir, true, nil
+	}
+
+	for _, m := range mod.candidates(importPath) {
+		root, err := mod.moduleDir(m)
+		if err != nil {
+			return "", false, err
+		}
+		sub, _ := hasPathPrefix(importPath, m.Path)
+		dir := filepath.Join(root, filepath.FromSlash(sub))
+		if i.isDir(dir) {
+			return dir, true, nil
+		}
+	}
+	return "", false, nil
+}
+
+func (i *Importer) findWorkspacePackage(work *workInfo, importPath string) (string, bool, error) {
+	mods := append([]*modInfo(nil), work.mods...)
+	sort.SliceStable(mods, func(i, j int) bool {
+		return len(mods[i].file.Module.Mod.Path) > len(mods[j].file.Module.Mod.Path)
+	})
+	for _, mod := range mods {
+		if sub, ok := hasPathPrefix(importPath, mod.file.Module.Mod.Path); ok {
+			dir := filepath.Join(mod.root, filepath.FromSlash(sub))
+			return dir, i.isDir(dir), nil
+		}
+	}
+	if isStandardImportPath(importPath) {
+		return "", false, nil
+	}
+
+	if vendorEnabled(i.isDir(filepath.Join(work.root, "vendor")), work.file.Go, "v1.22") {
+		dir := filepath.Join(work.root, "vendor", filepath.FromSlash(importPath))
+		if !i.isDir(dir) {
+			return "", false, &PackageNotFoundError{Path: importPath, Dir: filepath.Join(work.root, "vendor")}
+		}
+		return dir, true, nil
+	}
+
+	for _, m := range work.candidates(importPath) {
+		root, err := work.moduleDir(m)
+		if err != nil {
+			return "", false, err
+		}
+		sub, _ := hasPathPrefix(importPath, m.Path)
+		dir := filepath.Join(root, filepath.FromSlash(sub))
+		if i.isDir(dir) {
+			return dir, true, nil
+		}
+	}
+	return "", false, nil
+}
+
+func (i *Importer) findModule(dir string) (*modInfo, error) {
+	for {
+		mod, err := i.readModule(dir)
+		if mod != nil || err != nil {
+			return mod, err
+		}
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return nil, nil
+		}
+		dir = parent
+	}
+}
+
+func (i *Importer) readModule(dir string) (*modInfo, error) {
+	gomod := filepath.Join(dir, "go.mod")
+	data, err := i.readFile(gomod)
+	if err != nil {
+		return nil, nil
+	}
+	f, err := modfile.Parse(gomod, data, nil)
+	if err != nil {
+		return nil, fmt.Errorf("parse %v: %w", gomod, err)
+	}
+	if f.Module == nil {
+		return nil, fmt.Errorf("%v: no module declaration", gomod)
+	}
+	return &modInfo{root: dir, file: f}, nil
+}
+
+func (i *Importer) findWorkspace(dir string) (*workInfo, error) {
+	gowork := os.Getenv("GOWORK")
+	switch gowork {
+	case "off":
+		return nil, nil
+	case "":
+		for {
+			if p := filepath.Join(dir, "go.work"); i.isFile(p) {
+				gowork = p
+				break
+			}
+			parent := filepath.Dir(dir)
+			if parent == dir {
+				return nil, nil
+			}
+			dir = parent
+		}
+	}
+
+	data, err := i.readFile(gowork)
+	if err != nil {
+		return nil, fmt.Errorf("read %v: %w", gowork, err)
+	}
+	f, err := modfile.ParseWork(gowork, data, nil)
+	if err != nil {
+		return nil, fmt.Errorf("parse %v: %w", gowork, err)
+	}
+	work := &workInfo{root: filepath.Dir(gowork), file: f}
+	for _, use := range f.Use {
+		root := filepath.FromSlash(use.Path)
+		if !filepath.IsAbs(root) {
+			root = filepath.Join(work.root, root)
+		}
+		mod, err := i.readModule(root)
+		if err != nil {
+			return nil, err
+		}
+		if mod == nil {
+			return nil, fmt.Errorf("%v: no go.mod in %v", gowork, use.Path)
+		}
+		work.mods = append(work.mods, mod)
+	}
+	return work, nil
+}
+
+func vendorEnabled(hasVendor bool, goVersion *modfile.Go, minVersion string) bool {
+	switch goFlag("mod") {
+	case "vendor":
+		return true
+	case "mod", "readonly":
+		return false
+	}
+	if !hasVendor {
+		return false
+	}
+	return goVersion != nil && semver.Compare("v"+goVersion.Version, minVersion) >= 0
+}
+
+func (m *modInfo) candidates(importPath string) []module.Version {
+	requires := make([]module.Version, 0, len(m.file.Require))
+	for _, r := range m.file.Require {
+		requires = append(requires, r.Mod)
+	}
+	return candidates(importPath, requires, m.file.Replace)
+}
+
+func (m *modInfo) moduleDir(v module.Version) (string, error) {
+	target, _ := replaceModule(m.file.Replace, m.root, v)
+	return moduleDir(m.modCache, target)
+}
+
+func (w *workInfo) candidates(importPath string) []module.Version {
+	versions := map[string]string{}
+	var paths []string
+	replaces := append([]*modfile.Replace(nil), w.file.Replace...)
+	for _, m := range w.mods {
+		for _, r := range m.file.Require {
+			v, ok := versions[r.Mod.Path]
+			if !ok {
+				paths = append(paths, r.Mod.Path)
+			}
+			if !ok || semver.Compare(r.Mod.Version, v) > 0 {
+				versions[r.Mod.Path] = r.Mod.Version
+			}
+		}
+		replaces = append(replaces, m.file.Replace...)
+	}
+	requires := make([]module.Version, 0, len(paths))
+	for _, p := range paths {
+		requires = append(requires, module.Version{Path: p, Version: versions[p]})
+	}
+	return candidates(importPath, requires, replaces)
+}
+
+func (w *workInfo) moduleDir(v module.Version) (string, error) {
+	if target, ok := replaceModule(w.file.Replace, w.root, v); ok {
+		return moduleDir(w.modCache, target)
+	}
+	for _, m := range w.mods {
+		if target, ok := replaceModule(m.file.Replace, m.root, v); ok {
+			return moduleDir(w.modCache, target)
+		}
+	}
+	return moduleDir(w.modCache, v)
+}
+
+func candidates(importPath string, requires []module.Version, replaces []*modfile.Replace) []module.Version {
+	var mods []module.Version
+	seen := map[string]bool{}
+	add := func(v module.Version) {
+		if seen[v.Path] {
+			return
+		}
+		if _, ok := hasPathPrefix(importPath, v.Path); !ok {
+			return
+		}
+		seen[v.Path] = true
+		mods = append(mods, v)
+	}
+	for _, r := range requires {
+		add(r)
+	}
+	for _, r := range replaces {
+		add(r.Old)
+	}
+	sort.SliceStable(mods, func(i, j int) bool {
+		return len(mods[i].Path) > len(mods[j].Path)
+	})
+	return mods
+}
+
+// replaceModule applies replace directives declared in the go.mod or go.work at root.
+func replaceModule(replaces []*modfile.Replace, root string, v module.Version) (module.Version, bool) {
+	target, ok := v, false
+	for _, r := range replaces {
+		if r.Old.Path != v.Path || (r.Old.Version != "" && r.Old.Version != v.Version) {
+			continue
+		}
+		target, ok = r.New, true
+		if r.Old.Version != "" {
+			break
+		}
+	}
+	if ok && target.Version == "" && !filepath.IsAbs(target.Path) {
+		target.Path = filepath.Join(root, filepath.FromSlash(target.Path))
+	}
+	return target, ok
+}
+
+func moduleDir(modCache string, v module.Version) (string, error) {
+	if v.Version == "" {
+		return v.Path, nil
+	}
+	return moduleCacheDir(modCache, v)
+}
+
+func moduleCacheDir(root string, v module.Version) (string, error) {
+	escPath, err := module.EscapePath(v.Path)
+	if err != nil {
+		return "", fmt.Errorf("escape module path(%v): %w", v.Path, err)
+	}
+	escVersion, err := module.EscapeVersion(v.Version)
+	if err != nil {
+		return "", fmt.Errorf("escape module version(%v): %w", v.Version, err)
+	}
+	return filepath.Join(root, filepath.FromSlash(escPath)+"@"+escVersion), nil
+}
+
+func modCacheRoot(ctx *build.Context) string {
+	if dir := os.Getenv("GOMODCACHE"); dir != "" {
+		return dir
+	}
+	gopath := filepath.SplitList(ctx.GOPATH)
+	if len(gopath) == 0 {
+		return ""
+	}
+	return filepath.Join(gopath[0], "pkg", "mod")
+}
+
+func goFlag(name string) string {
+	for _, f := range strings.Fields(os.Getenv("GOFLAGS")) {
+		f = strings.TrimLeft(f, "-")
+		if v, ok := strings.CutPrefix(f, name+"="); ok {
+			return v
+		}
+	}
+	return ""
+}
+
+func isStandardImportPath(importPath string) bool {
+	elem, _, _ := strings.Cut(importPath, "/")
+	return !strings.Contains(elem, ".")
+}
+
+func hasPathPrefix(p, prefix string) (string, bool) {
+	if p == prefix {
+		return "", true
+	}
+	if strings.HasPrefix(p, prefix+"/") {
+		return p[len(prefix)+1:], true
+	}
+	return "", false
+}
+
+func hasSubdir(root, dir string) (string, bool) {
+	rel, err := filepath.Rel(root, dir)
+	if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return "", false
+	}
+	return rel, true
+}
@@ -0,0 +1,283 @@
+package impast_test
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/orisano/impast"
+)
+
+func writeFiles(t *testing.T, root string, files map[string]string) {
+	t.Helper()
+	for name, src := range files {
+		p := filepath.Join(root, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(p), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(p, []byte(src), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestImporter_ImportPackageModule(t *testing.T) {
+	modCache := t.TempDir()
+	writeFiles(t, modCache, map[string]string{
+		"example.com/dep@v1.2.0/sub/sub.go":        "package sub\n\ntype Dep struct{}\n",
+		"example.com/dep@v1.1.0/sub/sub.go":        "package sub\n\ntype Old struct{}\n",
+		"example.com/!upper@v1.0.0/upper.go":       "package upper\n\ntype Upper struct{}\n",
+		"example.com/fork@v0.3.0/replaced/fork.go": "package replaced\n\ntype Fork struct{}\n",
+	})
+	t.Setenv("GOMODCACHE", modCache)
+	t.Setenv("GOFLAGS", "-mod=mod")
+
+	root := t.TempDir()
+	writeFiles(t, root, map[string]string{
+		"go.mod": `module example.com/app
+
+go 1.21
+
+require (
+	example.com/dep v1.2.0
+	example.com/Upper v1.0.0
+	example.com/local v0.0.0
+	example.com/replaced v1.0.0
+)
+
+replace example.com/local => ./local
+
+replace example.com/replaced => example.com/fork v0.3.0
+`,
+		"app.go":          "package app\n",
+		"internal/x/x.go": "package x\n\ntype X struct{}\n",
+		"local/local.go":  "package local\n\ntype Local struct{}\n",
+	})
+	t.Chdir(root)
+
+	tests := []struct {
+		importPath string
+		typeName   string
+	}{
+		{importPath: "example.com/app/internal/x", typeName: "X"},
+		{importPath: "example.com/dep/sub", typeName: "Dep"},
+		{importPath: "example.com/Upper", typeName: "Upper"},
+		{importPath: "example.com/local", typeName: "Local"},
+		{importPath: "example.com/replaced/replaced", typeName: "Fork"},
+	}
+	for _, test := range tests {
+		imp := &impast.Importer{}
+		pkg, err := imp.ImportPackage(test.importPath)
+		if err != nil {
+			t.Errorf("failed to import %q: %v", test.importPath, err)
+			continue
+		}
+		if impast.FindStruct(pkg, test.typeName) == nil {
+			t.Errorf("%v.%v not found", test.importPath, test.typeName)
+		}
+	}
+}
+
+func TestImporter_ImportPackageDotlessModule(t *testing.T) {
+	t.Setenv("GOFLAGS", "-mod=mod")
+	t.Setenv("GOWORK", "")
+
+	root := t.TempDir()
+	writeFiles(t, root, map[string]string{
+		"app/go.mod":          "module myapp\n\ngo 1.21\n",
+		"app/app.go":          "package app\n",
+		"app/internal/x/x.go": "package x\n\ntype X struct{}\n",
+		"work/go.work":        "go 1.21\n\nuse ./storage\n",
+		"work/storage/go.mod": "module storage\n\ngo 1.21\n",
+		"work/storage/s.go":   "package storage\n\ntype Client struct{}\n",
+	})
+
+	tests := []struct {
+		dir        string
+		importPath string
+		typeName   string
+	}{
+		{dir: "app", importPath: "myapp/internal/x", typeName: "X"},
+		{dir: "work/storage", importPath: "storage", typeName: "Client"},
+		{dir: "app", importPath: "errors", typeName: ""},
+	}
+	for _, test := range tests {
+		// the overlay disables the fallback to go list in go/build.
+		imp := &impast.Importer{
+			Dir:     filepath.Join(root, test.dir),
+			Overlay: map[string][]byte{filepath.Join(root, "app", "doc.go"): []byte("package app\n")},
+		}
+		pkg, err := imp.ImportPackage(test.importPath)
+		if err != nil {
+			t.Errorf("failed to import %q: %v", test.importPath, err)
+			continue
+		}
+		if test.typeName != "" && impast.FindStruct(pkg, test.typeName) == nil {
+			t.Errorf("%v.%v not found", test.importPath, test.typeName)
+		}
+	}
+}
+
+func TestImporter_ImportPackageModules(t *testing.T) {
+	t.Setenv("GOFLAGS", "-mod=mod")
+	t.Setenv("GOWORK", "")
+
+	root := t.TempDir()
+	for _, m := range []string{"a", "b"} {
+		writeFiles(t, root, map[string]string{
+			m + "/go.mod": `module example.com/` + m + `
+
+go 1.21
+
+require example.com/dep v1.0.0
+
+replace example.com/dep => ./dep
+`,
+			m + "/" + m + ".go": "package " + m + "\n",
+			m + "/dep/go.mod":   "module example.com/dep\n",
+			m + "/dep/dep.go":   "package dep\n\ntype " + strings.ToUpper(m) + " struct{}\n",
+		})
+	}
+
+	imp := &impast.Importer{EnableCache: true}
+	for _, m := range []string{"a", "b"} {
+		pkg, err := imp.ImportFrom("example.com/dep", filepath.Join(root, m))
+		if err != nil {
+			t.Fatalf("failed to import from %v: %v", m, err)
+		}
+		if impast.FindStruct(pkg, strings.ToUpper(m)) == nil {
+			t.Errorf("example.com/dep must be resolved in module %v", m)
+		}
+	}
+	if n := len(imp.Cached()); n != 2 {
+		t.Errorf("unexpected cached entries: %v", imp.Cached())
+	}
+	imp.Invalidate("example.com/dep")
+	if n := len(imp.Cached()); n != 0 {
+		t.Errorf("invalidated entries are still cached: %v", imp.Cached())
+	}
+}
+
+func TestImporter_Dir(t *testing.T) {
+	t.Setenv("GOFLAGS", "-mod=mod")
+	root := t.TempDir()
+	writeFiles(t, root, map[string]string{
+		"go.mod": "module example.com/app\n\ngo 1.21\n",
+		"foo/foo.go": `package foo
+
+import "example.com/app/bar"
+
+type Foo struct {
+	Base
+	bar.Bar
+}
+
+type Base struct{}
+
+func (b *Base) BaseDo() {}
+`,
+		"bar/bar.go": `package bar
+
+type Bar struct{}
+
+func (b *Bar) BarDo() {}
+`,
+	})
+
+	imp := &impast.Importer{Dir: filepath.Join(root, "foo")}
+	pkg, err := imp.ImportPackage(".")
+	if err != nil {
+		t.Fatalf("failed to import self package: %v", err)
+	}
+	if pkg.Name != "foo" {
+		t.Fatalf("unexpected package name. expected: foo, but got: %v", pkg.Name)
+	}
+	if _, err := imp.ImportPackage("../bar"); err != nil {
+		t.Errorf("failed to import relative package: %v", err)
+	}
+
+	methods, err := imp.GetMethodsDeep(pkg, "Foo")
+	if err != nil {
+		t.Fatalf("failed to get methods: %v", err)
+	}
+	var got []string
+	for _, m := range methods {
+		got = append(got, m.Name.Name)
+	}
+	if expected := []string{"BarDo", "BaseDo"}; !reflect.DeepEqual(got, expected) {
+		t.Errorf("unexpected methods. expected: %v, but got: %v", expected, got)
+	}
+}
+
+func TestImporter_ImportPackageWorkspace(t *testing.T) {
+	modCache := t.TempDir()
+	writeFiles(t, modCache, map[string]string{
+		"example.com/dep@v1.2.0/dep.go": "package dep\n\ntype New struct{}\n",
+		"example.com/dep@v1.1.0/dep.go": "package dep\n\ntype Old struct{}\n",
+	})
+	t.Setenv("GOMODCACHE", modCache)
+	t.Setenv("GOFLAGS", "-mod=mod")
+	t.Setenv("GOWORK", "")
+
+	root := t.TempDir()
+	writeFiles(t, root, map[string]string{
+		"go.work": `go 1.21
+
+use (
+	./app
+	./storage
+)
+
+replace example.com/replaced => ./fork
+`,
+		"app/go.mod": `module example.com/app
+
+go 1.21
+
+require (
+	example.com/dep v1.1.0
+	example.com/replaced v1.0.0
+)
+
+replace example.com/replaced => ../missing
+`,
+		"app/app.go": "package app\n",
+		"storage/go.mod": `module example.com/storage
+
+go 1.21
+
+require example.com/dep v1.2.0
+`,
+		"storage/client.go": "package storage\n\ntype Client struct{}\n",
+		"fork/go.mod":       "module example.com/replaced\n",
+		"fork/fork.go":      "package replaced\n\ntype Fork struct{}\n",
+	})
+
+	tests := []struct {
+		importPath string
+		typeName   string
+	}{
+		{importPath: "example.com/storage", typeName: "Client"},
+		{importPath: "example.com/dep", typeName: "New"},
+		{importPath: "example.com/replaced", typeName: "Fork"},
+	}
+	for _, test := range tests {
+		imp := &impast.Importer{Dir: filepath.Join(root, "app")}
+		pkg, err := imp.ImportPackage(test.importPath)
+		if err != nil {
+			t.Errorf("failed to import %q: %v", test.importPath, err)
+			continue
+		}
+		if impast.FindStruct(pkg, test.typeName) == nil {
+			t.Errorf("%v.%v not found", test.importPath, test.typeName)
+		}
+	}
+
+	t.Setenv("GOWORK", "off")
+	imp := &impast.Importer{Dir: filepath.Join(root, "app")}
+	if _, err := imp.ImportPackage("example.com/storage"); err == nil {
+		t.Error("expected error with GOWORK=off")
+	}
+}
@@ -0,0 +1,237 @@
+package impast
+
+import (
+	"go/ast"
+	"slices"
+)
+
+func ExportGenericType(pkg *ast.Package, tparams *ast.FieldList, expr ast.Expr) ast.Expr {
+	return exportType(pkg, expr, typeParamNames(tparams))
+}
+
+func ExportTypeParams(pkg *ast.Package, tparams *ast.FieldList) *ast.FieldList {
+	names := typeParamNames(tparams)
+	return mapFields(tparams, func(id *ast.Ident) ast.Expr {
+		return qualify(pkg, id, names)
+	})
+}
+
+func exportType(pkg *ast.Package, expr ast.Expr, scope []string) ast.Expr {
+	return mapType(expr, func(id *ast.Ident) ast.Expr {
+		return qualify(pkg, id, scope)
+	})
+}
+
+func qualify(pkg *ast.Package, id *ast.Ident, scope []string) ast.Expr {
+	if !id.IsExported() || slices.Contains(scope, id.Name) {
+		return id
+	}
+	return &ast.SelectorExpr{Sel: id, X: ast.NewIdent(pkg.Name)}
+}
+
+func substitute(expr ast.Expr, m map[string]ast.Expr) ast.Expr {
+	if len(m) == 0 {
+		return expr
+	}
+	return mapType(expr, func(id *ast.Ident) ast.Expr {
+		if r, ok := m[id.Name]; ok {
+			return r
+		}
+		return id
+	})
+}
+
+func substituteFields(fields []*ast.Field, tparams *ast.FieldList, args []ast.Expr) []*ast.Field {
+	m := typeArgMap(tparams, args)
+	if len(m) == 0 {
+		return fields
+	}
+	sfields := make([]*ast.Field, 0, len(fields))
+	for _, field := range fields {
+		sfield := *field
+		sfield.Type = substitute(field.Type, m)
+		sfields = append(sfields, &sfield)
+	}
+	return sfields
+}
+
+func substituteFunc(fn *ast.FuncDecl, m map[string]ast.Expr) *ast.FuncDecl {
+	if len(m) == 0 {
+		return fn
+	}
+	sfn := *fn
+	sfn.Type = substitute(fn.Type, m).(*ast.FuncType)
+	return &sfn
+}
+
+func typeArgMap(tparams *ast.FieldList, args []ast.Expr) map[string]ast.Expr {
+	names := typeParamNames(tparams)
+	if len(names) != len(args) {
+		return nil
+	}
+	m := make(map[string]ast.Expr, len(names))
+	for i, name := range names {
+		m[name] = args[i]
+	}
+	return m
+}
+
+func typeParamNames(tparams *ast.FieldList) []string {
+	if tparams == nil {
+		return nil
+	}
+	var names []string
+	for _, field := range tparams.List {
+		for _, name := range field.Names {
+			names = append(names, name.Name)
+		}
+	}
+	return names
+}
+
+func baseType(expr ast.Expr) ast.Expr {
+	if se, ok := expr.(*ast.StarExpr); ok {
+		expr = se.X
+	}
+	switch e := expr.(type) {
+	case *ast.IndexExpr:
+		return e.X
+	case *ast.IndexListExpr:
+		return e.X
+	}
+	return expr
+}
+
+func typeArgs(expr ast.Expr) []ast.Expr {
+	if se, ok := expr.(*ast.StarExpr); ok {
+		expr = se.X
+	}
+	switch e := expr.(type) {
+	case *ast.IndexExpr:
+		return []ast.Expr{e.Index}
+	case *ast.IndexListExpr:
+		return e.Indices
+	}
+	return nil
+}
+
+func stripTypeArgs(expr ast.Expr) ast.Expr {
+	if se, ok := expr.(*ast.StarExpr); ok {
+		return &ast.StarExpr{Star: se.Star, X: baseType(se.X)}
+	}
+	return baseType(expr)
+}
+
+func recvTypeParamNames(fn *ast.FuncDecl) []string {
+	if fn.Recv == nil || len(fn.Recv.List) == 0 {
+		return nil
+	}
+	var names []string
+	for _, arg := range typeArgs(fn.Recv.List[0].Type) {
+		if id, ok := arg.(*ast.Ident); ok {
+			names = append(names, id.Name)
+		}
+	}
+	return names
+}
+
+func mapFields(fields *ast.FieldList, f func(*ast.Ident) ast.Expr) *ast.FieldList {
+	return mapFieldNames(fields, f, nil)
+}
+
+func mapFieldNames(fields *ast.FieldList, f func(*ast.Ident) ast.Expr, sel func(*ast.SelectorExpr) ast.Expr) *ast.FieldList {
+	if fields == nil {
+		return nil
+	}
+	mfields := *fields
+	mfields.List = make([]*ast.Field, len(fields.List))
+	for i, field := range fields.List {
+		mfield := *field
+		mfield.Type = mapNames(field.Type, f, sel)
+		mfields.List[i] = &mfield
+	}
+	return &mfields
+}
+
+func mapType(expr ast.Expr, f func(*ast.Ident) ast.Expr) ast.Expr {
+	return mapNames(expr, f, nil)
+}
+
+// mapNames rewrites the type names of expr. Qualified names are passed to sel, if any.
+func mapNames(expr ast.Expr, f func(*ast.Ident) ast.Expr, sel func(*ast.SelectorExpr) ast.Expr) ast.Expr {
+	switch e := expr.(type) {
+	case nil:
+		return nil
+	case *ast.Ident:
+		return f(e)
+	case *ast.SelectorExpr:
+		if sel == nil {
+			return expr
+		}
+		return sel(e)
+	case *ast.StarExpr:
+		c := *e
+		c.X = mapNames(e.X, f, sel)
+		return &c
+	case *ast.ParenExpr:
+		c := *e
+		c.X = mapNames(e.X, f, sel)
+		return &c
+	case *ast.UnaryExpr:
+		c := *e
+		c.X = mapNames(e.X, f, sel)
+		return &c
+	case *ast.BinaryExpr:
+		c := *e
+		c.X = mapNames(e.X, f, sel)
+		c.Y = mapNames(e.Y, f, sel)
+		return &c
+	case *ast.ArrayType:
+		c := *e
+		c.Len = mapNames(e.Len, f, sel)
+		c.Elt = mapNames(e.Elt, f, sel)
+		return &c
+	case *ast.MapType:
+		c := *e
+		c.Key = mapNames(e.Key, f, sel)
+		c.Value = mapNames(e.Value, f, sel)
+		return &c
+	case *ast.ChanType:
+		c := *e
+		c.Value = mapNames(e.Value, f, sel)
+		return &c
+	case *ast.Ellipsis:
+		c := *e
+		c.Elt = mapNames(e.Elt, f, sel)
+		return &c
+	case *ast.FuncType:
+		c := *e
+		c.TypeParams = mapFieldNames(e.TypeParams, f, sel)
+		c.Params = mapFieldNames(e.Params, f, sel)
+		c.Results = mapFieldNames(e.Results, f, sel)
+		return &c
+	case *ast.InterfaceType:
+		c := *e
+		c.Methods = mapFieldNames(e.Methods, f, sel)
+		return &c
+	case *ast.StructType:
+		c := *e
+		c.Fields = mapFieldNames(e.Fields, f, sel)
+		return &c
+	case *ast.IndexExpr:
+		c := *e
+		c.X = mapNames(e.X, f, sel)
+		c.Index = mapNames(e.Index, f, sel)
+		return &c
+	case *ast.IndexListExpr:
+		c := *e
+		c.X = mapNames(e.X, f, sel)
+		c.Indices = make([]ast.Expr, len(e.Indices))
+		for i, index := range e.Indices {
+			c.Indices[i] = mapNames(index, f, sel)
+		}
+		return &c
+	default:
+		return expr
+	}
+}
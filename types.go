@@ -0,0 +1,155 @@
+package impast
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"go/ast"
+	"go/parser"
+	"go/printer"
+	"go/token"
+	"go/types"
+	"sync"
+)
+
+var errTypeCheckDisabled = errors.New("type checking is disabled")
+
+type typesEntry struct {
+	once sync.Once
+	pkg  *types.Package
+	err  error
+}
+
+type typesImporter struct {
+	i *Importer
+	// checking holds the packages being checked by the callers, to detect import cycles.
+	checking map[string]bool
+}
+
+func (ti *typesImporter) Import(path string) (*types.Package, error) {
+	return ti.ImportFrom(path, ti.i.srcDir(nil), 0)
+}
+
+func (ti *typesImporter) ImportFrom(path, dir string, _ types.ImportMode) (*types.Package, error) {
+	if path == "unsafe" {
+		return types.Unsafe, nil
+	}
+	pkg, err := ti.i.ImportFrom(path, dir)
+	if err != nil {
+		return nil, err
+	}
+	return ti.i.typesPackage(pkg, ti.checking)
+}
+
+func TypesPackage(pkg *ast.Package) (*types.Package, error) {
+	return DefaultImporter.TypesPackage(pkg)
+}
+
+func (i *Importer) TypesPackage(pkg *ast.Package) (*types.Package, error) {
+	return i.typesPackage(pkg, nil)
+}
+
+func (i *Importer) typesPackage(pkg *ast.Package, checking map[string]bool) (*types.Package, error) {
+	if !i.TypeCheck {
+		return nil, errTypeCheckDisabled
+	}
+	info, ok := i.loadedPackage(pkg)
+	if !ok {
+		return nil, fmt.Errorf("package %v is not loaded by importer: %w", pkg.Name, &PackageNotFoundError{Path: pkg.Name})
+	}
+	if checking[info.path] {
+		return nil, fmt.Errorf("import cycle not allowed: %v", info.path)
+	}
+	e, _ := i.typesPkgs.LoadOrStore(info.path, &typesEntry{})
+	entry := e.(*typesEntry)
+	entry.once.Do(func() {
+		chain := make(map[string]bool, len(checking)+1)
+		for p := range checking {
+			chain[p] = true
+		}
+		chain[info.path] = true
+		entry.pkg, entry.err = i.check(pkg, info, chain)
+	})
+	return entry.pkg, entry.err
+}
+
+func (i *Importer) check(pkg *ast.Package, info *pkgInfo, checking map[string]bool) (*types.Package, error) {
+	names := sortedNames(pkg.Files)
+	files := make([]*ast.File, 0, len(names))
+	for _, name := range names {
+		f := pkg.Files[name]
+		if !info.parsed {
+			// positions of files loaded from outside are meaningless for the importer's FileSet.
+			var err error
+			f, err = i.reparse(name, f)
+			if err != nil {
+				return nil, err
+			}
+		}
+		files = append(files, f)
+	}
+
+	ctx := i.buildContext()
+	conf := types.Config{
+		Importer:         &typesImporter{i: i, checking: checking},
+		FakeImportC:      true,
+		IgnoreFuncBodies: true,
+		Sizes:            types.SizesFor(ctx.Compiler, ctx.GOARCH),
+		// type errors are tolerated so that partially broken packages still yield usable objects.
+		Error: func(error) {},
+	}
+	tpkg, err := conf.Check(info.path, i.FileSet(), files, nil)
+	if tpkg == nil {
+		return nil, fmt.Errorf("type check %v: %w", info.path, err)
+	}
+	return tpkg, nil
+}
+
+func LookupNamed(pkg *ast.Package, name string) (*types.Named, error) {
+	return DefaultImporter.LookupNamed(pkg, name)
+}
+
+func (i *Importer) LookupNamed(pkg *ast.Package, name string) (*types.Named, error) {
+	tpkg, err := i.TypesPackage(pkg)
+	if err != nil {
+		return nil, fmt.Errorf("types package(%v): %w", pkg.Name, err)
+	}
+	obj, ok := tpkg.Scope().Lookup(name).(*types.TypeName)
+	if !ok {
+		return nil, &TypeNotFoundError{Package: tpkg.Path(), Name: name}
+	}
+	named, ok := types.Unalias(obj.Type()).(*types.Named)
+	if !ok {
+		return nil, fmt.Errorf("%v.%v is not a named type: %w", tpkg.Path(), name, &TypeNotFoundError{Package: tpkg.Path(), Name: name})
+	}
+	return named, nil
+}
+
+func ResolveNamed(f *ast.File, expr ast.Expr) (*types.Named, error) {
+	return DefaultImporter.ResolveNamed(f, expr)
+}
+
+func (i *Importer) ResolveNamed(f *ast.File, expr ast.Expr) (*types.Named, error) {
+	pkg, name, err := i.ResolveType(f, expr)
+	if err != nil {
+		return nil, fmt.Errorf("resolve type: %w", err)
+	}
+	if pkg == nil {
+		if pkg = i.filePackage(f); pkg == nil {
+			return nil, fmt.Errorf("file is not loaded by importer: %w", PackageNotFound)
+		}
+	}
+	return i.LookupNamed(pkg, name)
+}
+
+func (i *Importer) reparse(name string, f *ast.File) (*ast.File, error) {
+	var b bytes.Buffer
+	if err := printer.Fprint(&b, token.NewFileSet(), f); err != nil {
+		return nil, fmt.Errorf("print %v: %w", name, err)
+	}
+	rf, err := parser.ParseFile(i.FileSet(), name, b.Bytes(), 0)
+	if err != nil {
+		return nil, fmt.Errorf("reparse %v: %w", name, err)
+	}
+	return rf, nil
+}
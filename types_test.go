@@ -0,0 +1,158 @@
+package impast_test
+
+import (
+	"go/ast"
+	gotypes "go/types"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/orisano/impast"
+)
+
+func TestImporter_LookupNamed(t *testing.T) {
+	imp := &impast.Importer{EnableCache: true, TypeCheck: true}
+	imp.Load(map[string]*ast.Package{
+		"example.com/foo": {
+			Name: "foo",
+			Files: map[string]*ast.File{
+				"foo.go": mustParseFile(`
+package foo
+
+import "example.com/bar"
+
+type Foo struct {
+	bar.Bar
+	rw bar.ReadWriter
+}
+
+type Alias = Foo
+
+func (f Foo) Do() {}
+`),
+			},
+		},
+		"example.com/bar": {
+			Name: "bar",
+			Files: map[string]*ast.File{
+				"bar.go": mustParseFile(`
+package bar
+
+import "io"
+
+type Bar struct{}
+
+func (b *Bar) BarDo() {}
+
+type ReadWriter interface {
+	io.Reader
+	io.Writer
+}
+`),
+			},
+		},
+	})
+
+	pkg, err := imp.ImportPackage("example.com/foo")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name     string
+		pointer  bool
+		expected []string
+	}{
+		{name: "Foo", expected: []string{"Do"}},
+		{name: "Foo", pointer: true, expected: []string{"BarDo", "Do"}},
+		{name: "Alias", pointer: true, expected: []string{"BarDo", "Do"}},
+	}
+	for _, test := range tests {
+		named, err := imp.LookupNamed(pkg, test.name)
+		if err != nil {
+			t.Errorf("failed to lookup %v: %v", test.name, err)
+			continue
+		}
+		var typ gotypes.Type = named
+		if test.pointer {
+			typ = gotypes.NewPointer(named)
+		}
+		ms := gotypes.NewMethodSet(typ)
+		var got []string
+		for i := 0; i < ms.Len(); i++ {
+			got = append(got, ms.At(i).Obj().Name())
+		}
+		if !reflect.DeepEqual(got, test.expected) {
+			t.Errorf("unexpected method set(%v). expected: %v, but got: %v", test.name, test.expected, got)
+		}
+	}
+
+	barPkg, err := imp.ImportPackage("example.com/bar")
+	if err != nil {
+		t.Fatal(err)
+	}
+	rw, err := imp.LookupNamed(barPkg, "ReadWriter")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n := rw.Underlying().(*gotypes.Interface).NumMethods(); n != 2 {
+		t.Errorf("unexpected number of methods. expected: 2, but got: %v", n)
+	}
+
+	if _, err := (&impast.Importer{}).TypesPackage(pkg); err == nil {
+		t.Error("expected error when type checking is disabled")
+	}
+}
+
+func TestImporter_TypesPackageCycle(t *testing.T) {
+	imp := &impast.Importer{EnableCache: true, TypeCheck: true}
+	pkgs := map[string]*ast.Package{
+		"example.com/c1": {
+			Name: "c1",
+			Files: map[string]*ast.File{
+				"c1.go": mustParseFile(`
+package c1
+
+import "example.com/c2"
+
+type C1 struct {
+	c2.C2
+}
+`),
+			},
+		},
+		"example.com/c2": {
+			Name: "c2",
+			Files: map[string]*ast.File{
+				"c2.go": mustParseFile(`
+package c2
+
+import "example.com/c1"
+
+type C2 struct {
+	*c1.C1
+}
+`),
+			},
+		},
+	}
+	imp.Load(pkgs)
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		tpkg, err := imp.TypesPackage(pkgs["example.com/c1"])
+		if err != nil {
+			t.Errorf("failed to type check: %v", err)
+			return
+		}
+		if tpkg.Scope().Lookup("C1") == nil {
+			t.Error("C1 is not found")
+		}
+	}()
+	select {
+	case <-done:
+	case <-time.After(10 * time.Second):
+		t.Fatal("type checking an import cycle does not finish")
+	}
+}
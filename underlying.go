@@ -0,0 +1,102 @@
+package impast
+
+import (
+	"fmt"
+	"go/ast"
+)
+
+type typeRef struct {
+	pkg  *ast.Package
+	file *ast.File
+	expr ast.Expr
+}
+
+func Underlying(pkg *ast.Package, name string) (*ast.Package, *ast.File, ast.Expr, error) {
+	return DefaultImporter.Underlying(pkg, name)
+}
+
+// Underlying follows aliases and defined types from name to its underlying type.
+// The returned expression belongs to the returned package and file; type arguments
+// met on the way are substituted, so the only free type parameters are those of name.
+func (i *Importer) Underlying(pkg *ast.Package, name string) (*ast.Package, *ast.File, ast.Expr, error) {
+	typeSpec, f := i.FindTypeSpec(pkg, name)
+	if typeSpec == nil {
+		return nil, nil, nil, &TypeNotFoundError{Package: i.pkgPath(pkg), Name: name}
+	}
+	ref, err := i.follow(pkg, f, typeSpec, true)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	return ref.pkg, ref.file, ref.expr, nil
+}
+
+// follow resolves the type names in the definition of spec. Only aliases are followed
+// unless defined is set, in which case it stops at the first type literal.
+func (i *Importer) follow(pkg *ast.Package, f *ast.File, spec *ast.TypeSpec, defined bool) (typeRef, error) {
+	ref := typeRef{pkg: pkg, file: f, expr: spec.Type}
+	scope := typeParamNames(spec.TypeParams)
+	seen := map[*ast.TypeSpec]bool{spec: true}
+	for defined || spec.Assign.IsValid() {
+		named, args, ok := namedType(ref.expr)
+		if !ok {
+			break
+		}
+		p, file, ts, err := i.lookupNamed(ref.pkg, ref.file, named)
+		if err != nil {
+			return typeRef{}, err
+		}
+		if ts == nil {
+			break
+		}
+		if seen[ts] {
+			return typeRef{}, &RecursiveTypeError{Pos: i.position(file, ts), Name: ts.Name.Name}
+		}
+		seen[ts] = true
+
+		exported := make([]ast.Expr, 0, len(args))
+		for _, arg := range args {
+			exported = append(exported, i.exportTypeIn(ref.pkg, ref.file, arg, scope))
+		}
+		ref = typeRef{pkg: p, file: file, expr: substitute(ts.Type, typeArgMap(ts.TypeParams, exported))}
+		spec = ts
+	}
+	return ref, nil
+}
+
+// lookupNamed finds the declaration of a type name. It returns a nil spec for predeclared types.
+func (i *Importer) lookupNamed(pkg *ast.Package, f *ast.File, named ast.Expr) (*ast.Package, *ast.File, *ast.TypeSpec, error) {
+	switch t := named.(type) {
+	case *ast.Ident:
+		ts, file := i.FindTypeSpec(pkg, t.Name)
+		return pkg, file, ts, nil
+	case *ast.SelectorExpr:
+		x, ok := t.X.(*ast.Ident)
+		if !ok {
+			return nil, nil, nil, fmt.Errorf("unexpected qualifier: %v", TypeName(t.X))
+		}
+		p, err := i.ResolvePackage(f, x.Name)
+		if err != nil {
+			return nil, nil, nil, fmt.Errorf("resolve package(%v): %w", x.Name, err)
+		}
+		ts, file := i.FindTypeSpec(p, t.Sel.Name)
+		if ts == nil {
+			return nil, nil, nil, &TypeNotFoundError{Pos: i.position(f, t), Package: i.pkgPath(p), Name: t.Sel.Name}
+		}
+		return p, file, ts, nil
+	}
+	return nil, nil, nil, fmt.Errorf("unexpected type name: %v", TypeName(named))
+}
+
+func namedType(expr ast.Expr) (ast.Expr, []ast.Expr, bool) {
+	switch e := expr.(type) {
+	case *ast.ParenExpr:
+		return namedType(e.X)
+	case *ast.Ident, *ast.SelectorExpr:
+		return e, nil, true
+	case *ast.IndexExpr:
+		return e.X, []ast.Expr{e.Index}, true
+	case *ast.IndexListExpr:
+		return e.X, e.Indices, true
+	}
+	return nil, nil, false
+}
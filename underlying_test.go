@@ -0,0 +1,113 @@
+package impast_test
+
+import (
+	"go/ast"
+	"reflect"
+	"testing"
+
+	"github.com/orisano/impast"
+)
+
+func TestImporter_Underlying(t *testing.T) {
+	dir := t.TempDir()
+	writeFiles(t, dir, map[string]string{
+		"go.mod": "module example.com/m\n",
+		"other/other.go": `package other
+
+type Item struct{}
+
+type Base[T any] struct{}
+
+func (b *Base[T]) Get() T { var v T; return v }
+
+type Client struct {
+	Base[Item]
+}
+
+func (c *Client) Do(req *Item) error { return nil }
+
+type Getter interface {
+	Get() Item
+}
+`,
+		"foo/foo.go": `package foo
+
+import "example.com/m/other"
+
+type Client = other.Client
+
+type Alias = Client
+
+type MyClient other.Client
+
+func (c *MyClient) Own() {}
+
+type IntBase = other.Base[int]
+
+type Generic[T any] = other.Base[T]
+
+type MyGetter other.Getter
+
+type Getter = other.Getter
+
+type Number int
+`,
+	})
+
+	imp := &impast.Importer{Dir: dir}
+	pkg, err := imp.ImportPackage("./foo")
+	if err != nil {
+		t.Fatalf("failed to import: %v", err)
+	}
+
+	methods := []struct {
+		name     string
+		expected []string
+	}{
+		{name: "Client", expected: []string{"Do(*other.Item)(error)", "Get()(other.Item)"}},
+		{name: "Alias", expected: []string{"Do(*other.Item)(error)", "Get()(other.Item)"}},
+		{name: "MyClient", expected: []string{"Get()(other.Item)", "Own()()"}},
+		{name: "IntBase", expected: []string{"Get()(int)"}},
+		{name: "Generic", expected: []string{"Get()(T)"}},
+	}
+	for _, test := range methods {
+		got, err := imp.GetMethodsDeep(pkg, test.name)
+		if err != nil {
+			t.Errorf("failed to get methods(%v): %v", test.name, err)
+			continue
+		}
+		var sigs []string
+		for _, m := range got {
+			sigs = append(sigs, signature(m))
+		}
+		if !reflect.DeepEqual(sigs, test.expected) {
+			t.Errorf("unexpected methods(%v). expected: %v, but got: %v", test.name, test.expected, sigs)
+		}
+	}
+
+	for _, name := range []string{"Client", "Alias", "MyClient", "IntBase"} {
+		if imp.FindStruct(pkg, name) == nil {
+			t.Errorf("FindStruct(%v) must follow the type", name)
+		}
+	}
+	for _, name := range []string{"MyGetter", "Getter"} {
+		if imp.FindInterface(pkg, name) == nil {
+			t.Errorf("FindInterface(%v) must follow the type", name)
+		}
+	}
+	if _, ok := imp.FindTypeByName(pkg, "Alias").(*ast.StructType); !ok {
+		t.Error("FindTypeByName must follow aliases")
+	}
+	if got := impast.TypeName(imp.FindTypeByName(pkg, "MyClient")); got != "other.Client" {
+		t.Errorf("FindTypeByName must not follow defined types, but got: %v", got)
+	}
+
+	p, _, expr, err := imp.Underlying(pkg, "Number")
+	if err != nil || p != pkg || impast.TypeName(expr) != "int" {
+		t.Errorf("unexpected underlying of Number: %v, %v", impast.TypeName(expr), err)
+	}
+	p, _, _, err = imp.Underlying(pkg, "IntBase")
+	if err != nil || p.Name != "other" {
+		t.Errorf("unexpected underlying package of IntBase: %v", err)
+	}
+}